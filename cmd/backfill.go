@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage/db"
+	"github.com/kv-base-hack/base-server-api/worker"
+	"github.com/kv-base-hack/common/logger"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	backfillChain     = "chain"
+	backfillFromBlock = "from-block"
+	backfillToBlock   = "to-block"
+	backfillFromTime  = "from-time"
+	backfillToTime    = "to-time"
+	backfillOutput    = "output"
+	backfillServerURL = "server-url"
+)
+
+// NewBackfillCommand creates the command to rebuild the storage of a chain from a block or time range of the database.
+func NewBackfillCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "backfill",
+		Usage: "replay the logs of a block or time range into a snapshot, run it again to resume",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     backfillChain,
+				Usage:    "chain to backfill, it must be in the chain config",
+				Required: true,
+			},
+			&cli.Int64Flag{
+				Name:  backfillFromBlock,
+				Usage: "first block of the range",
+			},
+			&cli.Int64Flag{
+				Name:  backfillToBlock,
+				Usage: "last block of the range",
+			},
+			&cli.StringFlag{
+				Name:  backfillFromTime,
+				Usage: "start of the range in RFC3339, instead of from-block and to-block",
+			},
+			&cli.StringFlag{
+				Name:  backfillToTime,
+				Usage: "end of the range in RFC3339, now if empty",
+			},
+			&cli.StringFlag{
+				Name:     backfillOutput,
+				Usage:    "path of the snapshot, the progress is saved next to it",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  backfillServerURL,
+				Usage: "url of a running server to upload the snapshot to with the admin token, e.g. http://localhost:8080",
+			},
+		},
+		Action: backfill,
+	}
+}
+
+func backfill(c *cli.Context) error {
+	logger, flusher, err := logger.NewLogger(c)
+	if err != nil {
+		return err
+	}
+	defer flusher()
+	log := logger.Sugar()
+
+	chainConfigs, err := ChainConfigsFromContext(c)
+	if err != nil {
+		log.Errorw("error when load chain config", "err", err)
+		return err
+	}
+	chain, err := common.ChainString(c.String(backfillChain))
+	if err != nil {
+		return err
+	}
+	var config *common.ChainConfig
+	for i := range chainConfigs {
+		if chainConfigs[i].Chain == chain {
+			config = &chainConfigs[i]
+		}
+	}
+	if config == nil {
+		return fmt.Errorf("chain %s is not in the chain config", chain)
+	}
+
+	store, err := NewStorageFromContext(c, log, chainConfigs)
+	if err != nil {
+		return err
+	}
+	// trades are valued at the current rates like the running server
+	worker.NewGetRate(log, NewRedisFromContext(c), c.Duration(getRateDuration), store, config.Chain, config.RateKey, nil).Init()
+
+	database, err := NewDBFromContext(c)
+	if err != nil {
+		log.Errorw("error when connect to database", "err", err)
+		return err
+	}
+	defer database.Close()
+
+	b := worker.NewBackfill(log, db.NewPostgres(database), store, *config, c.String(backfillOutput))
+	fromBlock, toBlock, err := backfillRange(c, b)
+	if err != nil {
+		return err
+	}
+	if err := b.Run(fromBlock, toBlock); err != nil {
+		log.Errorw("error when backfill", "err", err)
+		return err
+	}
+
+	if serverURL := c.String(backfillServerURL); serverURL != "" {
+		return uploadSnapshot(log, serverURL, c.String(adminToken), chain, c.String(backfillOutput))
+	}
+	return nil
+}
+
+// backfillRange returns the block range from the block flags or the time flags.
+func backfillRange(c *cli.Context, b *worker.Backfill) (int64, int64, error) {
+	if c.String(backfillFromTime) == "" {
+		if !c.IsSet(backfillFromBlock) || !c.IsSet(backfillToBlock) {
+			return 0, 0, fmt.Errorf("missing %s and %s, or %s", backfillFromBlock, backfillToBlock, backfillFromTime)
+		}
+		return c.Int64(backfillFromBlock), c.Int64(backfillToBlock), nil
+	}
+
+	from, err := time.Parse(time.RFC3339, c.String(backfillFromTime))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid %s: %w", backfillFromTime, err)
+	}
+	to := time.Now()
+	if c.String(backfillToTime) != "" {
+		if to, err = time.Parse(time.RFC3339, c.String(backfillToTime)); err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %w", backfillToTime, err)
+		}
+	}
+	return b.BlockRange(from, to)
+}
+
+// uploadSnapshot sends the snapshot to the admin api of a running server, it replaces the data of the chain.
+func uploadSnapshot(log *zap.SugaredLogger, serverURL, token string, chain common.Chain, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	u := strings.TrimSuffix(serverURL, "/") + "/admin/snapshot?" + url.Values{"chain": {chain.String()}}.Encode()
+	req, err := http.NewRequest(http.MethodPut, u, f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload snapshot: status %d: %s", resp.StatusCode, body)
+	}
+	log.Infow("uploaded snapshot", "server", serverURL, "chain", chain, "response", string(body))
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage/db"
+	"github.com/kv-base-hack/base-server-api/worker"
+	"github.com/urfave/cli/v2"
+)
+
+const chainConfigFlag = "chain-config"
+
+// NewChainConfigFlags creates new cli flags for chain configuration.
+func NewChainConfigFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    chainConfigFlag,
+			Usage:   "path of the json file of chain configs, only base chain is served if empty",
+			EnvVars: []string{"CHAIN_CONFIG"},
+		},
+	}
+}
+
+// ChainConfigsFromContext returns the configs of the chains to serve.
+// Without config file, base chain is configured from the legacy flags.
+func ChainConfigsFromContext(c *cli.Context) ([]common.ChainConfig, error) {
+	if c.Int64(confirmationBlocks) < 0 {
+		return nil, fmt.Errorf("negative %s", confirmationBlocks)
+	}
+	path := c.String(chainConfigFlag)
+	if path == "" {
+		return []common.ChainConfig{
+			{
+				Chain:         common.ChainBase,
+				TradeTable:    db.SolanaTradeTable,
+				TransferTable: db.SolanaTransferTable,
+				FromBlock:     c.Int64(solFromBlock),
+				MaxRangeBlock: c.Int64(maxRangeBlock),
+				RateKey:       worker.DefaultRatePricesKey,
+
+				ConfirmationBlocks: c.Int64(confirmationBlocks),
+			},
+		}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read chain config: %w", err)
+	}
+	var configs []common.ChainConfig
+	if err := json.Unmarshal(content, &configs); err != nil {
+		return nil, fmt.Errorf("parse chain config: %w", err)
+	}
+
+	seen := make(map[common.Chain]bool)
+	for i, cfg := range configs {
+		// a config without chain unmarshals to the zero chain
+		if !cfg.Chain.IsAChain() {
+			return nil, fmt.Errorf("invalid chain %d of config %d", cfg.Chain, i)
+		}
+		if seen[cfg.Chain] {
+			return nil, fmt.Errorf("duplicated config of chain %s", cfg.Chain)
+		}
+		seen[cfg.Chain] = true
+		if cfg.TradeTable == "" || cfg.TransferTable == "" {
+			return nil, fmt.Errorf("missing trade or transfer table of chain %s", cfg.Chain)
+		}
+		if cfg.RateKey == "" {
+			configs[i].RateKey = worker.DefaultRatePricesKey
+		}
+		if cfg.ConfirmationBlocks < 0 {
+			return nil, fmt.Errorf("negative confirmation blocks of chain %s", cfg.Chain)
+		}
+		if cfg.ConfirmationBlocks == 0 {
+			configs[i].ConfirmationBlocks = c.Int64(confirmationBlocks)
+		}
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no chain in chain config %s", path)
+	}
+	return configs, nil
+}
+
+// setupLogTables creates the notify triggers and the position indexes of the log tables of a chain.
+func setupLogTables(pg *db.Postgres, cfg common.ChainConfig) error {
+	for _, table := range []string{cfg.TradeTable, cfg.TransferTable} {
+		if err := pg.SetupLogTable(table); err != nil {
+			return fmt.Errorf("setup table %s: %w", table, err)
+		}
+	}
+	return nil
+}
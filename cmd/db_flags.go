@@ -14,6 +14,7 @@ const (
 	postgresUserFlag     = "postgres-user"
 	postgresPasswordFlag = "postgres-password"
 	postgresDatabaseFlag = "postgres-database"
+	postgresNotifyFlag   = "postgres-notify"
 )
 
 // NewPostgreSQLFlags creates new cli flags for PostgreSQL client.
@@ -39,20 +40,29 @@ func NewPostgreSQLFlags() []cli.Flag {
 			Name:    postgresPortFlag,
 			EnvVars: []string{"POSTGRES_PORT"},
 		},
+		&cli.BoolFlag{
+			Name:    postgresNotifyFlag,
+			Usage:   "get new logs on LISTEN/NOTIFY, it needs the triggers in migrations/schemas",
+			EnvVars: []string{"POSTGRES_NOTIFY"},
+		},
 	}
 }
 
 // NewDBFromContext creates a DB instance from cli flags configuration.
 func NewDBFromContext(c *cli.Context) (*sqlx.DB, error) {
 	const driverName = "postgres"
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+	return sqlx.Connect(driverName, ConnStrFromContext(c))
+}
+
+// ConnStrFromContext returns the connection string of the database from cli flags configuration.
+func ConnStrFromContext(c *cli.Context) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		c.String(postgresHostFlag),
 		c.Int(postgresPortFlag),
 		c.String(postgresUserFlag),
 		c.String(postgresPasswordFlag),
 		c.String(postgresDatabaseFlag),
 	)
-	return sqlx.Connect(driverName, connStr)
 }
 
 // DatabaseNameFromContext return database name
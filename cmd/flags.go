@@ -3,15 +3,37 @@ package main
 import (
 	"time"
 
+	"github.com/kv-base-hack/base-server-api/storage"
 	"github.com/urfave/cli/v2"
 )
 
 const (
 	getDataFromDbDuration = "get-data-from-db-duration"
+	pollFallbackDuration  = "poll-fallback-duration"
 	getRateDuration       = "get-rate-duration"
 	tokenInfoDuration     = "token-info-duration"
 	solFromBlock          = "sol-from-block"
 	maxRangeBlock         = "max-range-block"
+	confirmationBlocks    = "confirmation-blocks"
+	compactLogsDuration   = "compact-logs-duration"
+	snapshotDir           = "snapshot-dir"
+	snapshotDuration      = "snapshot-duration"
+	pnlMethod             = "pnl-method"
+	bigTxMinUsd           = "big-tx-min-usd"
+	bigTxPercentile       = "big-tx-percentile"
+	bigTxPercentileMinUsd = "big-tx-percentile-min-usd"
+	adminToken            = "admin-token"
+	maxSnapshotBytes      = "max-snapshot-bytes"
+	shutdownTimeout       = "shutdown-timeout"
+	snapshotOnShutdown    = "snapshot-on-shutdown"
+	readyMaxLogsAge       = "ready-max-logs-age"
+	readyMaxLagBlocks     = "ready-max-lag-blocks"
+	readyMaxRateAge       = "ready-max-rate-age"
+	readyMaxTokenInfoAge  = "ready-max-token-info-age"
+	labelsFile            = "labels-file"
+	alertReloadDuration   = "alert-reload-duration"
+	webhookTimeout        = "webhook-timeout"
+	webhookMaxAttempts    = "webhook-max-attempts"
 )
 
 // NewFlags creates new cli flags.
@@ -23,6 +45,12 @@ func NewFlags() []cli.Flag {
 			Usage:   "duration to get new log from database",
 			EnvVars: []string{"GET_DATA_FROM_DB_DURATION"},
 		},
+		&cli.DurationFlag{
+			Name:    pollFallbackDuration,
+			Value:   time.Minute,
+			Usage:   "duration to get new log from database when postgres notify is connected",
+			EnvVars: []string{"POLL_FALLBACK_DURATION"},
+		},
 		&cli.Int64Flag{
 			Name:    solFromBlock,
 			EnvVars: []string{"SOL_FROM_BLOCK"},
@@ -31,6 +59,80 @@ func NewFlags() []cli.Flag {
 			Name:    maxRangeBlock,
 			EnvVars: []string{"MAX_RANGE_BLOCK"},
 		},
+		&cli.Int64Flag{
+			Name:    confirmationBlocks,
+			Value:   32,
+			Usage:   "number of latest blocks that are checked again for reorg, 0 to disable",
+			EnvVars: []string{"CONFIRMATION_BLOCKS"},
+		},
+		&cli.DurationFlag{
+			Name:    compactLogsDuration,
+			Value:   time.Minute * 10,
+			Usage:   "duration to drop logs that are out of the longest range from memory",
+			EnvVars: []string{"COMPACT_LOGS_DURATION"},
+		},
+		&cli.StringFlag{
+			Name:    snapshotDir,
+			Usage:   "directory of the storage snapshots, one file per chain, empty to disable snapshot",
+			EnvVars: []string{"SNAPSHOT_DIR"},
+		},
+		&cli.DurationFlag{
+			Name:    snapshotDuration,
+			Value:   time.Minute * 10,
+			Usage:   "duration to write storage snapshot",
+			EnvVars: []string{"SNAPSHOT_DURATION"},
+		},
+		&cli.BoolFlag{
+			Name:    snapshotOnShutdown,
+			Value:   true,
+			Usage:   "write the storage snapshot on shutdown, it needs snapshot-dir",
+			EnvVars: []string{"SNAPSHOT_ON_SHUTDOWN"},
+		},
+		&cli.DurationFlag{
+			Name:    shutdownTimeout,
+			Value:   time.Second * 30,
+			Usage:   "how long to wait for the in-flight requests, then for the workers on shutdown",
+			EnvVars: []string{"SHUTDOWN_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    pnlMethod,
+			Value:   string(storage.PnlMethodFifo),
+			Usage:   "cost basis method of wallet pnl: fifo or avg",
+			EnvVars: []string{"PNL_METHOD"},
+		},
+		&cli.Float64Flag{
+			Name:    bigTxMinUsd,
+			Value:   storage.DefaultBigTxMinUsd,
+			Usage:   "minimum usd value of a big transaction of the chains without big_tx.min_usd config",
+			EnvVars: []string{"BIG_TX_MIN_USD"},
+		},
+		&cli.Float64Flag{
+			Name:    bigTxPercentile,
+			Usage:   "flag the trades above this percentile of the token trade size in the last 24h as big transaction, 0 to disable",
+			EnvVars: []string{"BIG_TX_PERCENTILE"},
+		},
+		&cli.Float64Flag{
+			Name:    bigTxPercentileMinUsd,
+			Value:   1_000,
+			Usage:   "minimum usd value of a big transaction flagged by percentile",
+			EnvVars: []string{"BIG_TX_PERCENTILE_MIN_USD"},
+		},
+		&cli.StringFlag{
+			Name:    labelsFile,
+			Usage:   "json or csv file of the wallet labels, see config/labels.example.csv",
+			EnvVars: []string{"LABELS_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    adminToken,
+			Usage:   "bearer token of the admin api, empty to disable the admin api",
+			EnvVars: []string{"ADMIN_TOKEN"},
+		},
+		&cli.Int64Flag{
+			Name:    maxSnapshotBytes,
+			Value:   2 << 30,
+			Usage:   "maximum size in bytes of a snapshot uploaded to the admin api",
+			EnvVars: []string{"MAX_SNAPSHOT_BYTES"},
+		},
 		&cli.DurationFlag{
 			Name:    getRateDuration,
 			Value:   time.Second * 10,
@@ -43,5 +145,47 @@ func NewFlags() []cli.Flag {
 			Usage:   "duration to get token info from redis",
 			EnvVars: []string{"GET_TOKEN_INFO_DURATION"},
 		},
+		&cli.DurationFlag{
+			Name:    readyMaxLogsAge,
+			Value:   time.Minute * 5,
+			Usage:   "the instance is not ready if the logs of a chain are not processed successfully for this duration",
+			EnvVars: []string{"READY_MAX_LOGS_AGE"},
+		},
+		&cli.Int64Flag{
+			Name:    readyMaxLagBlocks,
+			Value:   300,
+			Usage:   "the instance is not ready if the logs of a chain are more blocks behind the database, 0 to disable",
+			EnvVars: []string{"READY_MAX_LAG_BLOCKS"},
+		},
+		&cli.DurationFlag{
+			Name:    readyMaxRateAge,
+			Value:   time.Minute * 5,
+			Usage:   "the instance is not ready if the rates of a chain are not updated for this duration",
+			EnvVars: []string{"READY_MAX_RATE_AGE"},
+		},
+		&cli.DurationFlag{
+			Name:    readyMaxTokenInfoAge,
+			Value:   time.Minute * 30,
+			Usage:   "the instance is not ready if the token info is not updated for this duration",
+			EnvVars: []string{"READY_MAX_TOKEN_INFO_AGE"},
+		},
+		&cli.DurationFlag{
+			Name:    alertReloadDuration,
+			Value:   time.Minute,
+			Usage:   "duration to reload the alert rules from database, the rules changed by the admin api are reloaded at once",
+			EnvVars: []string{"ALERT_RELOAD_DURATION"},
+		},
+		&cli.DurationFlag{
+			Name:    webhookTimeout,
+			Value:   time.Second * 10,
+			Usage:   "timeout of a webhook post",
+			EnvVars: []string{"WEBHOOK_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    webhookMaxAttempts,
+			Value:   5,
+			Usage:   "number of attempts to post an alert to a webhook",
+			EnvVars: []string{"WEBHOOK_MAX_ATTEMPTS"},
+		},
 	}
 }
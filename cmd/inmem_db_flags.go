@@ -1,6 +1,7 @@
 package main
 
 import (
+	inmem "github.com/kv-base-hack/common/inmem_db"
 	"github.com/urfave/cli/v2"
 )
 
@@ -34,3 +35,9 @@ func NewRedisFlags() []cli.Flag {
 		},
 	}
 }
+
+// NewRedisFromContext creates a redis client from cli flags configuration.
+func NewRedisFromContext(c *cli.Context) inmem.Inmem {
+	redisAddr := c.String(redisHostFlag) + ":" + c.String(redisPortFlag)
+	return inmem.NewRedisClient(redisAddr, c.String(redisPasswordFlag), c.Int(redisDBFlag))
+}
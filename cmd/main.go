@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
 	"sort"
+	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/alert"
+	"github.com/kv-base-hack/base-server-api/internal/health"
 	"github.com/kv-base-hack/base-server-api/internal/httputil"
+	"github.com/kv-base-hack/base-server-api/internal/metrics"
 	"github.com/kv-base-hack/base-server-api/internal/server"
 	"github.com/kv-base-hack/base-server-api/lib/coingecko"
 	"github.com/kv-base-hack/base-server-api/storage"
 	"github.com/kv-base-hack/base-server-api/storage/db"
+	"github.com/kv-base-hack/base-server-api/util"
 	"github.com/kv-base-hack/base-server-api/worker"
-	inmem "github.com/kv-base-hack/common/inmem_db"
 	"github.com/kv-base-hack/common/logger"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
@@ -21,10 +28,12 @@ func main() {
 	_ = godotenv.Load()
 	app := cli.NewApp()
 	app.Action = run
+	app.Commands = []*cli.Command{NewBackfillCommand()}
 	app.Flags = append(app.Flags, logger.NewSentryFlags()...)
 	app.Flags = append(app.Flags, NewPostgreSQLFlags()...)
 	app.Flags = append(app.Flags, NewRedisFlags()...)
 	app.Flags = append(app.Flags, NewFlags()...)
+	app.Flags = append(app.Flags, NewChainConfigFlags()...)
 	app.Flags = append(app.Flags, httputil.NewHTTPCliFlags(httputil.Port)...)
 
 	sort.Sort(cli.FlagsByName(app.Flags))
@@ -34,6 +43,39 @@ func main() {
 	}
 }
 
+// NewStorageFromContext creates the storage of the chains with the pnl method and big tx thresholds from cli flags.
+func NewStorageFromContext(c *cli.Context, log *zap.SugaredLogger, chainConfigs []common.ChainConfig) (*storage.Storage, error) {
+	method, err := storage.PnlMethodString(c.String(pnlMethod))
+	if err != nil {
+		log.Errorw("invalid pnl method", "err", err)
+		return nil, err
+	}
+	chains := make([]common.Chain, 0, len(chainConfigs))
+	quotes := util.NewQuoteRegistry()
+	exchanges := util.NewExchangeRegistry()
+	for _, cfg := range chainConfigs {
+		chains = append(chains, cfg.Chain)
+		quotes.Add(cfg.Chain, cfg.QuoteTokens...)
+		for exchange, wallets := range cfg.CexWallets {
+			exchanges.Add(cfg.Chain, exchange, wallets...)
+		}
+	}
+	store := storage.NewStorage(log, chains, quotes, exchanges, method)
+	for _, cfg := range chainConfigs {
+		threshold := cfg.BigTx.Threshold(common.BigTxThreshold{
+			MinUsd:           c.Float64(bigTxMinUsd),
+			Percentile:       c.Float64(bigTxPercentile),
+			PercentileMinUsd: c.Float64(bigTxPercentileMinUsd),
+		})
+		if err := store.SetBigTxThreshold(cfg.Chain, threshold); err != nil {
+			log.Errorw("invalid big tx threshold", "chain", cfg.Chain, "err", err)
+			return nil, err
+		}
+		store.SetConfirmationBlocks(cfg.Chain, uint64(cfg.ConfirmationBlocks))
+	}
+	return store, nil
+}
+
 func run(c *cli.Context) error {
 	logger, flusher, err := logger.NewLogger(c)
 	if err != nil {
@@ -45,7 +87,24 @@ func run(c *cli.Context) error {
 	log := logger.Sugar()
 	log.Debugw("Starting application...")
 
-	store := storage.NewStorage(log)
+	chainConfigs, err := ChainConfigsFromContext(c)
+	if err != nil {
+		log.Errorw("error when load chain config", "err", err)
+		return err
+	}
+	store, err := NewStorageFromContext(c, log, chainConfigs)
+	if err != nil {
+		return err
+	}
+	metrics.RegisterStorage(store)
+
+	labels := util.NewLabelRegistry()
+	if path := c.String(labelsFile); path != "" {
+		if err := labels.LoadFile(path); err != nil {
+			log.Errorw("error when load labels", "err", err)
+			return err
+		}
+	}
 
 	database, err := NewDBFromContext(c)
 	if err != nil {
@@ -53,32 +112,81 @@ func run(c *cli.Context) error {
 		return err
 	}
 
+	defer database.Close()
 	pg := db.NewPostgres(database)
 
-	redisHost := c.String(redisHostFlag)
-	redisPort := c.String(redisPortFlag)
-	redisPassword := c.String(redisPasswordFlag)
-	redisDB := c.Int(redisDBFlag)
-	redisAddr := redisHost + ":" + redisPort
-	redis := inmem.NewRedisClient(redisAddr, redisPassword, redisDB)
+	// workers and server stop on SIGTERM or interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	supervisor := worker.NewSupervisor(log)
+
+	var notifier db.Notifier
+	if c.Bool(postgresNotifyFlag) {
+		pgNotifier, err := db.NewPgNotifier(log, ConnStrFromContext(c))
+		if err != nil {
+			log.Errorw("error when listen to database", "err", err)
+			return err
+		}
+		defer pgNotifier.Close()
+		go pgNotifier.Run()
+		notifier = pgNotifier
+	}
 
-	getRate := worker.NewGetRate(log, redis, c.Duration(getRateDuration), store)
-	getRate.Init()
-	go getRate.Run()
+	// the hooks are set before the logs are added
+	dispatcher := alert.NewDispatcher(log, c.Duration(webhookTimeout), c.Int(webhookMaxAttempts))
+	alerts := alert.NewEngine(log, store, pg, dispatcher, c.Duration(alertReloadDuration))
+	store.SetHooks(alerts.Hooks())
+	supervisor.Go(ctx, "alertDispatcher", dispatcher.Run)
+	supervisor.Go(ctx, "alertEngine", alerts.Run)
+
+	redis := NewRedisFromContext(c)
+	registry := health.NewRegistry()
+
+	for _, cfg := range chainConfigs {
+		status := registry.Register("rate-"+cfg.Chain.String(), c.Duration(readyMaxRateAge), 0)
+		getRate := worker.NewGetRate(log, redis, c.Duration(getRateDuration), store, cfg.Chain, cfg.RateKey, status)
+		getRate.Init()
+		supervisor.Go(ctx, "getRate-"+cfg.Chain.String(), getRate.Run)
+	}
 
-	tokenInfo := worker.NewTokenInfoWorker(log, c.Duration(tokenInfoDuration), redis, store)
+	tokenInfoStatus := registry.Register("tokenInfo", c.Duration(readyMaxTokenInfoAge), 0)
+	tokenInfo := worker.NewTokenInfoWorker(log, c.Duration(tokenInfoDuration), redis, store, tokenInfoStatus)
 	tokenInfo.Init()
-	go tokenInfo.Run()
-
-	solLogs := worker.NewSolanaLogs(log, c.Duration(getDataFromDbDuration),
-		pg, store, c.Int64(solFromBlock), c.Int64(maxRangeBlock))
-	go solLogs.Run()
+	supervisor.Go(ctx, "tokenInfo", tokenInfo.Run)
+
+	for _, cfg := range chainConfigs {
+		status := registry.Register("logs-"+cfg.Chain.String(), c.Duration(readyMaxLogsAge), c.Int64(readyMaxLagBlocks))
+		chainNotifier := notifier
+		if notifier != nil {
+			// without trigger the tables never notify, the worker polls every duration instead
+			if err := setupLogTables(pg, cfg); err != nil {
+				log.Warnw("error when setup log tables, fallback to polling", "chain", cfg.Chain, "err", err)
+				chainNotifier = nil
+			}
+		}
+		solLogs := worker.NewSolanaLogs(log, c.Duration(getDataFromDbDuration),
+			pg, store, cfg, c.Duration(compactLogsDuration),
+			c.String(snapshotDir), c.Duration(snapshotDuration), c.Bool(snapshotOnShutdown),
+			chainNotifier, c.Duration(pollFallbackDuration), status)
+		supervisor.Go(ctx, "solanaLogs-"+cfg.Chain.String(), solLogs.Run)
+	}
 
 	coingecko := coingecko.NewCoinGecko()
 	getTrendingWorker := worker.NewGetTrendingWorker(log, coingecko, store)
-	go getTrendingWorker.Run()
+	supervisor.Go(ctx, "getTrending", getTrendingWorker.Run)
 
 	host := httputil.NewHTTPAddressFromContext(c)
-	server := server.NewServer(host, store, redis)
-	return server.Run()
+	server := server.NewServer(host, store, redis, c.String(adminToken), c.Int64(maxSnapshotBytes),
+		registry, labels, alerts, pg)
+	err = server.Run(ctx, c.Duration(shutdownTimeout))
+	if err != nil {
+		log.Errorw("error when run server", "err", err)
+	}
+	// stop the workers if the server fails
+	stop()
+	if !supervisor.Wait(c.Duration(shutdownTimeout)) {
+		log.Warnw("workers are still running after the shutdown timeout")
+	}
+	log.Infow("shutdown")
+	return err
 }
@@ -0,0 +1,13 @@
+package common
+
+import "strings"
+
+// AddressKey returns the key of an address in the maps keyed by address.
+// Hex addresses of evm chains are case insensitive, they are lower cased. Base58 addresses of solana
+// are case sensitive and kept as is, they never start with "0x" as '0' is not in the base58 alphabet.
+func AddressKey(address string) string {
+	if strings.HasPrefix(address, "0x") || strings.HasPrefix(address, "0X") {
+		return strings.ToLower(address)
+	}
+	return address
+}
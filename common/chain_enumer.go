@@ -9,11 +9,11 @@ import (
 	"strings"
 )
 
-const _ChainName = "base"
+const _ChainName = "baseethereumarbitrumoptimismsolana"
 
-var _ChainIndex = [...]uint8{0, 4}
+var _ChainIndex = [...]uint8{0, 4, 12, 20, 28, 34}
 
-const _ChainLowerName = "base"
+const _ChainLowerName = "baseethereumarbitrumoptimismsolana"
 
 func (i Chain) String() string {
 	i -= 1
@@ -28,17 +28,33 @@ func (i Chain) String() string {
 func _ChainNoOp() {
 	var x [1]struct{}
 	_ = x[ChainBase-(1)]
+	_ = x[ChainEthereum-(2)]
+	_ = x[ChainArbitrum-(3)]
+	_ = x[ChainOptimism-(4)]
+	_ = x[ChainSolana-(5)]
 }
 
-var _ChainValues = []Chain{ChainBase}
+var _ChainValues = []Chain{ChainBase, ChainEthereum, ChainArbitrum, ChainOptimism, ChainSolana}
 
 var _ChainNameToValueMap = map[string]Chain{
-	_ChainName[0:4]:      ChainBase,
-	_ChainLowerName[0:4]: ChainBase,
+	_ChainName[0:4]:        ChainBase,
+	_ChainLowerName[0:4]:   ChainBase,
+	_ChainName[4:12]:       ChainEthereum,
+	_ChainLowerName[4:12]:  ChainEthereum,
+	_ChainName[12:20]:      ChainArbitrum,
+	_ChainLowerName[12:20]: ChainArbitrum,
+	_ChainName[20:28]:      ChainOptimism,
+	_ChainLowerName[20:28]: ChainOptimism,
+	_ChainName[28:34]:      ChainSolana,
+	_ChainLowerName[28:34]: ChainSolana,
 }
 
 var _ChainNames = []string{
 	_ChainName[0:4],
+	_ChainName[4:12],
+	_ChainName[12:20],
+	_ChainName[20:28],
+	_ChainName[28:34],
 }
 
 // ChainString retrieves an enum value from the enum constants string name.
@@ -0,0 +1,71 @@
+package common
+
+// ChainConfig is the configuration of a chain served by the server.
+type ChainConfig struct {
+	Chain         Chain  `json:"chain"`
+	TradeTable    string `json:"trade_table"`
+	TransferTable string `json:"transfer_table"`
+	// first block to get logs, the worker starts from max(FromBlock, latest block - MaxRangeBlock)
+	FromBlock     int64 `json:"from_block"`
+	MaxRangeBlock int64 `json:"max_range_block"`
+	// number of latest blocks that are checked again for reorg, 0 is from the flag
+	ConfirmationBlocks int64 `json:"confirmation_blocks"`
+	// redis key of the token rates of this chain
+	RateKey string `json:"rate_key"`
+	// added to the default quote tokens of this chain
+	QuoteTokens []QuoteToken `json:"quote_tokens"`
+	// rules to flag big transactions, the missing values are from the flags
+	BigTx BigTxThresholdConfig `json:"big_tx"`
+	// wallet addresses by exchange name, a transfer to or from these wallets is attributed to the exchange
+	CexWallets map[string][]string `json:"cex_wallets,omitempty"`
+}
+
+// BigTxThreshold is the rules of a chain to flag a trade or transfer as big transaction.
+// The first configured rule of the token is used: token, percentile then chain.
+type BigTxThreshold struct {
+	// minimum usd value of the chain
+	MinUsd float64 `json:"min_usd"`
+	// flag the values above this percentile of the trade size of the token in the last 24h,
+	// e.g. 99 is the top 1%, 0 to disable
+	Percentile float64 `json:"percentile"`
+	// minimum usd value of the percentile rule, so the small trades of thin tokens are not flagged
+	PercentileMinUsd float64 `json:"percentile_min_usd"`
+	// minimum usd value by token address, it overrides the other rules
+	Tokens map[string]float64 `json:"tokens,omitempty"`
+}
+
+// BigTxThresholdConfig is the BigTxThreshold of the chain config, a missing value is nil
+// so an explicit 0 is kept, e.g. percentile 0 disables the percentile rule of the chain.
+type BigTxThresholdConfig struct {
+	MinUsd           *float64           `json:"min_usd"`
+	Percentile       *float64           `json:"percentile"`
+	PercentileMinUsd *float64           `json:"percentile_min_usd"`
+	Tokens           map[string]float64 `json:"tokens,omitempty"`
+}
+
+// Threshold returns the configured rules, the missing values are from defaults.
+func (c BigTxThresholdConfig) Threshold(defaults BigTxThreshold) BigTxThreshold {
+	res := defaults
+	if c.MinUsd != nil {
+		res.MinUsd = *c.MinUsd
+	}
+	if c.Percentile != nil {
+		res.Percentile = *c.Percentile
+	}
+	if c.PercentileMinUsd != nil {
+		res.PercentileMinUsd = *c.PercentileMinUsd
+	}
+	if c.Tokens != nil {
+		res.Tokens = c.Tokens
+	}
+	return res
+}
+
+// QuoteToken is a token that is used to price other tokens in a swap.
+type QuoteToken struct {
+	Address string `json:"address"`
+	Symbol  string `json:"symbol"`
+	// when both tokens of a swap are quote tokens, the one with higher priority is the quote side,
+	// e.g. USDC has higher priority than WETH so WETH -> USDC is selling WETH
+	Priority int `json:"priority"`
+}
@@ -8,7 +8,11 @@ import (
 type Chain uint64
 
 const (
-	ChainBase Chain = iota + 1 // base
+	ChainBase     Chain = iota + 1 // base
+	ChainEthereum                  // ethereum
+	ChainArbitrum                  // arbitrum
+	ChainOptimism                  // optimism
+	ChainSolana                    // solana
 )
 
 // enumer -type=SourcePrice -linecomment -json=true -text=true -sql=true
@@ -30,6 +34,35 @@ const (
 	SmartMoneyActivitiesSelling                                  // selling
 )
 
+// enumer -type=LabelCategory -linecomment -json=true -text=true -sql=true
+type LabelCategory uint64
+
+const (
+	LabelCategoryCex         LabelCategory = iota + 1 // cex
+	LabelCategoryMarketMaker                          // market_maker
+	LabelCategoryFund                                 // fund
+	LabelCategoryTrader                               // trader
+	LabelCategoryContract                             // contract
+)
+
+// enumer -type=AlertKind -linecomment -json=true -text=true -sql=true
+type AlertKind uint64
+
+const (
+	AlertKindBigBuy              AlertKind = iota + 1 // big_buy
+	AlertKindCexInflow                                // cex_inflow
+	AlertKindLeaderboardPosition                      // leaderboard_position
+	AlertKindNetFlowFlip                              // net_flow_flip
+)
+
+// enumer -type=WatchlistKind -linecomment -json=true -text=true -sql=true
+type WatchlistKind uint64
+
+const (
+	WatchlistKindWallet WatchlistKind = iota + 1 // wallet
+	WatchlistKindToken                           // token
+)
+
 type Tradelog struct {
 	BlockTimestamp time.Time `json:"timestamp"`
 	BlockNumber    uint64    `json:"block_number"`
@@ -59,6 +92,7 @@ type Transferlog struct {
 	BlockNumber    uint64    `json:"block_number"`
 	TxIndex        uint      `json:"tx_index,omitempty"`
 	TxHash         string    `json:"tx_hash"`
+	LogIndex       uint      `json:"log_index"`
 
 	FromAddress string `json:"from_address"`
 	ToAddress   string `json:"to_address"`
@@ -66,6 +100,11 @@ type Transferlog struct {
 	TokenAddress string  `json:"token_in_address"`
 	TokenAmount  float64 `json:"token_in_amount"`
 	IsCexIn      bool    `json:"is_cex_in"`
+	// Exchange is the exchange of the cex wallet of the transfer, empty if the wallet is not registered
+	Exchange string `json:"exchange,omitempty"`
+	// FromExchange is the source exchange of a transfer between two registered cex wallets,
+	// Exchange is then the destination
+	FromExchange string `json:"from_exchange,omitempty"`
 
 	CurrentTokenUsdtRate float64
 	GetCurrentRateFail   bool
@@ -99,6 +138,59 @@ type BigTx struct {
 	Price          float64              `json:"price"`
 	Movement       string               `json:"movement"`
 	Action         SmartMoneyActivities `json:"action"`
+	// Rule is the threshold rule that flags the transaction, Threshold is its usd value
+	Rule      string  `json:"rule"`
+	Threshold float64 `json:"threshold"`
+	// Counterparty is the other address of a deposit or withdraw
+	Counterparty string `json:"counterparty,omitempty"`
+	// Seq is the order in which the transaction is added to the chain, it is the id of the stream events
+	Seq uint64 `json:"-"`
+}
+
+// WalletLabel is the name and category of an address.
+type WalletLabel struct {
+	Chain    Chain         `json:"chain"`
+	Address  string        `json:"address"`
+	Name     string        `json:"name"`
+	Category LabelCategory `json:"category"`
+}
+
+// AlertRule is a condition over the ingested data, the alerts are posted to WebhookURL.
+// The empty conditions match all.
+type AlertRule struct {
+	ID    int64     `json:"id"`
+	Name  string    `json:"name"`
+	Chain Chain     `json:"chain"`
+	Kind  AlertKind `json:"kind"`
+
+	// wallet of big_buy
+	Wallet string `json:"wallet,omitempty"`
+	// token of big_buy, cex_inflow and net_flow_flip
+	Token string `json:"token,omitempty"`
+	// window of cex_inflow and net_flow_flip, e.g. 1h
+	Duration string `json:"duration,omitempty"`
+	// minimum usd value of the buy, the inflow, the opened position or the net flow
+	MinUsd float64 `json:"min_usd,omitempty"`
+	// size of the leaderboard of leaderboard_position
+	TopWallets int `json:"top_wallets,omitempty"`
+	// cex or dex net flow of net_flow_flip
+	Source SourcePrice `json:"source,omitempty"`
+
+	WebhookURL string `json:"webhook_url"`
+	// key of the hmac signature of the payloads
+	Secret    string    `json:"secret,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Watchlist is a named set of wallets or tokens of a chain, the addresses are kept as given.
+type Watchlist struct {
+	ID        int64         `json:"id"`
+	Name      string        `json:"name"`
+	Chain     Chain         `json:"chain"`
+	Kind      WatchlistKind `json:"kind"`
+	Addresses []string      `json:"addresses"`
+	CreatedAt time.Time     `json:"created_at"`
 }
 
 type TokenBalance struct {
@@ -0,0 +1,91 @@
+package alert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/util"
+)
+
+var (
+	ErrInvalidRule  = errors.New("invalid alert rule")
+	ErrRuleNotFound = errors.New("alert rule not found")
+)
+
+// Alert is the payload posted to the webhook of a rule.
+type Alert struct {
+	// ID is the same for the same event of a rule, the receiver can use it to skip the retried alerts
+	ID       string           `json:"id"`
+	RuleID   int64            `json:"rule_id"`
+	RuleName string           `json:"rule_name"`
+	Kind     common.AlertKind `json:"kind"`
+	Chain    common.Chain     `json:"chain"`
+	Time     time.Time        `json:"time"`
+	Message  string           `json:"message"`
+	Data     interface{}      `json:"data"`
+}
+
+func newAlert(rule common.AlertRule, event string, ts time.Time, message string, data interface{}) Alert {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", rule.ID, event)))
+	return Alert{
+		ID:       hex.EncodeToString(h[:16]),
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		Kind:     rule.Kind,
+		Chain:    rule.Chain,
+		Time:     ts,
+		Message:  message,
+		Data:     data,
+	}
+}
+
+// normalize keys the addresses of the rule with common.AddressKey and checks the fields of its kind.
+func normalize(rule common.AlertRule) (common.AlertRule, error) {
+	rule.Wallet = common.AddressKey(strings.TrimSpace(rule.Wallet))
+	rule.Token = common.AddressKey(strings.TrimSpace(rule.Token))
+	rule.Name = strings.TrimSpace(rule.Name)
+
+	if rule.Name == "" {
+		return rule, fmt.Errorf("%w: missing name", ErrInvalidRule)
+	}
+	if !rule.Kind.IsAAlertKind() {
+		return rule, fmt.Errorf("%w: invalid kind", ErrInvalidRule)
+	}
+	if rule.MinUsd < 0 {
+		return rule, fmt.Errorf("%w: negative min_usd", ErrInvalidRule)
+	}
+	u, err := url.Parse(rule.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return rule, fmt.Errorf("%w: invalid webhook_url", ErrInvalidRule)
+	}
+
+	switch rule.Kind {
+	case common.AlertKindLeaderboardPosition:
+		if rule.TopWallets <= 0 {
+			return rule, fmt.Errorf("%w: top_wallets must be positive", ErrInvalidRule)
+		}
+	case common.AlertKindCexInflow, common.AlertKindNetFlowFlip:
+		if rule.Token == "" {
+			return rule, fmt.Errorf("%w: missing token", ErrInvalidRule)
+		}
+		if _, err := util.ParseDuration(rule.Duration); err != nil {
+			return rule, fmt.Errorf("%w: invalid duration", ErrInvalidRule)
+		}
+	}
+	if rule.Kind == common.AlertKindNetFlowFlip && !rule.Source.IsASourcePrice() {
+		return rule, fmt.Errorf("%w: invalid source", ErrInvalidRule)
+	}
+	return rule, nil
+}
+
+// sameRule returns true if the conditions of the rules are the same, the state of a changed rule is reset.
+func sameRule(a, b common.AlertRule) bool {
+	a.CreatedAt, b.CreatedAt = time.Time{}, time.Time{}
+	return a == b
+}
@@ -0,0 +1,201 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// dispatcherWorkers is the number of webhooks that are posted at the same time
+	dispatcherWorkers = 4
+	// dispatcherQueue is the number of alerts waiting for a worker before the new alerts are dropped
+	dispatcherQueue = 1024
+	// dedupTTL is how long an alert id is remembered, the same alert is sent once in this time
+	dedupTTL = 24 * time.Hour
+	// the delay before a retry is doubled on each attempt up to maxRetryDelay
+	firstRetryDelay = time.Second
+	maxRetryDelay   = time.Minute
+)
+
+type delivery struct {
+	url    string
+	secret string
+	alert  Alert
+}
+
+// Dispatcher posts the alerts to the webhooks of their rules, it retries the failed posts and skips
+// the alerts that are already sent.
+type Dispatcher struct {
+	log         *zap.SugaredLogger
+	client      *http.Client
+	maxAttempts int
+	queue       chan delivery
+
+	mutex sync.Mutex
+	sent  map[string]time.Time // alert id -> time it is queued
+}
+
+func NewDispatcher(log *zap.SugaredLogger, timeout time.Duration, maxAttempts int) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		log:         log.With("worker", "alertDispatcher"),
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		queue:       make(chan delivery, dispatcherQueue),
+		sent:        make(map[string]time.Time),
+	}
+}
+
+// Send queues the alert to the webhook of rule, it returns false if the alert is already sent or the queue is full.
+func (d *Dispatcher) Send(rule common.AlertRule, alert Alert) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exist := d.sent[alert.ID]; exist {
+		metrics.DeliverAlert(metrics.AlertDuplicated)
+		return false
+	}
+	select {
+	case d.queue <- delivery{url: rule.WebhookURL, secret: rule.Secret, alert: alert}:
+		d.sent[alert.ID] = time.Now()
+		return true
+	default:
+		d.log.Warnw("alert queue is full, drop alert", "alert", alert.ID, "rule", rule.ID)
+		metrics.DeliverAlert(metrics.AlertDropped)
+		return false
+	}
+}
+
+// Run posts the queued alerts until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < dispatcherWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.deliver(ctx, job)
+				}
+			}
+		}()
+	}
+
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case now := <-t.C:
+			d.pruneSent(now)
+		}
+	}
+}
+
+func (d *Dispatcher) pruneSent(now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for id, ts := range d.sent {
+		if now.Sub(ts) > dedupTTL {
+			delete(d.sent, id)
+		}
+	}
+}
+
+// deliver posts the alert until it succeeds, the attempts are exhausted or ctx is cancelled.
+func (d *Dispatcher) deliver(ctx context.Context, job delivery) {
+	body, err := json.Marshal(job.alert)
+	if err != nil {
+		d.log.Errorw("error when marshal alert", "alert", job.alert.ID, "err", err)
+		metrics.DeliverAlert(metrics.AlertFailed)
+		return
+	}
+
+	delay := firstRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, job, body)
+		if err == nil {
+			d.log.Debugw("delivered alert", "alert", job.alert.ID, "rule", job.alert.RuleID, "attempt", attempt)
+			metrics.DeliverAlert(metrics.AlertDelivered)
+			return
+		}
+		if !retry || attempt >= d.maxAttempts {
+			d.log.Errorw("error when deliver alert", "alert", job.alert.ID, "rule", job.alert.RuleID,
+				"attempt", attempt, "err", err)
+			metrics.DeliverAlert(metrics.AlertFailed)
+			return
+		}
+		d.log.Warnw("error when deliver alert, retry", "alert", job.alert.ID, "attempt", attempt,
+			"delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			metrics.DeliverAlert(metrics.AlertFailed)
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// post sends the alert once, it returns true if the error can be retried.
+func (d *Dispatcher) post(ctx context.Context, job delivery, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Alert-Id", job.alert.ID)
+	req.Header.Set("X-Alert-Timestamp", timestamp)
+	if job.secret != "" {
+		req.Header.Set("X-Alert-Signature", "sha256="+Sign(job.secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the hex hmac sha256 of timestamp.body with secret, the receiver checks X-Alert-Signature with it.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,475 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/storage/db"
+	"github.com/kv-base-hack/base-server-api/util"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxEventAge is the age of the oldest trade that is alerted, the history loaded on start is not alerted
+	maxEventAge = 15 * time.Minute
+	// positionQueue is the number of opened positions waiting for the engine before the new ones are dropped
+	positionQueue = 1024
+	// leaderboardDuration is the window of the leaderboard, the same as the leaderboard api
+	leaderboardDuration = 24 * time.Hour
+	// leaderboardCacheDuration is how long the ranks of the leaderboard are reused
+	leaderboardCacheDuration = time.Minute
+)
+
+type positionEvent struct {
+	chain common.Chain
+	log   common.Tradelog
+}
+
+type flowState struct {
+	rule  common.AlertRule
+	value float64
+}
+
+type leaderboard struct {
+	computedAt time.Time
+	ranks      map[string]int // wallet -> rank from 1
+}
+
+// Engine evaluates the alert rules as the logs are added to storage and sends the alerts to the dispatcher:
+//   - big_buy on the big buys of the wallet or token
+//   - leaderboard_position when a wallet of the leaderboard buys a token it didn't hold
+//   - cex_inflow when the cex in flow of the token goes above min_usd
+//   - net_flow_flip when the net flow of the token changes sign
+//
+// The flow rules are compared to their value of the previous evaluation, the first evaluation of a rule
+// doesn't send alerts.
+type Engine struct {
+	log            *zap.SugaredLogger
+	storage        *storage.Storage
+	db             db.AlertDB
+	dispatcher     *Dispatcher
+	reloadDuration time.Duration
+
+	mutex sync.RWMutex
+	rules []common.AlertRule
+
+	reload    chan struct{}
+	positions chan positionEvent
+	logsAdded chan struct{}
+
+	pendingMutex sync.Mutex
+	pending      map[common.Chain]bool
+
+	// only used by the run loop
+	flows        map[int64]flowState
+	leaderboards map[common.Chain]leaderboard
+}
+
+func NewEngine(log *zap.SugaredLogger, storage *storage.Storage, db db.AlertDB, dispatcher *Dispatcher,
+	reloadDuration time.Duration) *Engine {
+	return &Engine{
+		log:            log.With("worker", "alertEngine"),
+		storage:        storage,
+		db:             db,
+		dispatcher:     dispatcher,
+		reloadDuration: reloadDuration,
+		reload:         make(chan struct{}, 1),
+		positions:      make(chan positionEvent, positionQueue),
+		logsAdded:      make(chan struct{}, 1),
+		pending:        make(map[common.Chain]bool),
+		flows:          make(map[int64]flowState),
+		leaderboards:   make(map[common.Chain]leaderboard),
+	}
+}
+
+// Hooks returns the storage hooks that notify the engine, they don't block the ingestion.
+func (e *Engine) Hooks() storage.Hooks {
+	return storage.Hooks{
+		PositionOpened: func(chain common.Chain, log common.Tradelog) {
+			if time.Since(log.BlockTimestamp) > maxEventAge || !e.hasRules(chain, common.AlertKindLeaderboardPosition) {
+				return
+			}
+			select {
+			case e.positions <- positionEvent{chain: chain, log: log}:
+			default:
+				e.log.Warnw("position queue is full, drop position", "chain", chain, "tx", log.TxHash)
+			}
+		},
+		LogsAdded: func(chain common.Chain) {
+			e.pendingMutex.Lock()
+			e.pending[chain] = true
+			e.pendingMutex.Unlock()
+			select {
+			case e.logsAdded <- struct{}{}:
+			default:
+			}
+		},
+	}
+}
+
+// Run evaluates the rules until ctx is cancelled, the rules are reloaded from database every reloadDuration.
+func (e *Engine) Run(ctx context.Context) {
+	if err := e.load(); err != nil {
+		e.log.Errorw("error when load alert rules", "err", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, chain := range e.storage.GetChains() {
+		wg.Add(1)
+		go func(chain common.Chain) {
+			defer wg.Done()
+			e.watchBigBuys(ctx, chain)
+		}(chain)
+	}
+	defer wg.Wait()
+
+	t := time.NewTicker(e.reloadDuration)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := e.load(); err != nil {
+				e.log.Errorw("error when load alert rules", "err", err)
+			}
+		case <-e.reload:
+			if err := e.load(); err != nil {
+				e.log.Errorw("error when load alert rules", "err", err)
+			}
+		case event := <-e.positions:
+			e.onPositionOpened(event.chain, event.log)
+		case <-e.logsAdded:
+			e.pendingMutex.Lock()
+			chains := e.pending
+			e.pending = make(map[common.Chain]bool)
+			e.pendingMutex.Unlock()
+			for chain := range chains {
+				e.evaluateFlows(chain)
+			}
+		}
+	}
+}
+
+// Reload loads the rules again on the run loop.
+func (e *Engine) Reload() {
+	select {
+	case e.reload <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) load() error {
+	rules, err := e.db.GetAlertRules()
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	e.rules = rules
+	e.mutex.Unlock()
+	e.log.Debugw("loaded alert rules", "rules", len(rules))
+	return nil
+}
+
+// rulesOf returns the enabled rules of kind on chain.
+func (e *Engine) rulesOf(chain common.Chain, kind common.AlertKind) []common.AlertRule {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	var res []common.AlertRule
+	for _, rule := range e.rules {
+		if rule.Enabled && rule.Chain == chain && rule.Kind == kind {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
+
+func (e *Engine) hasRules(chain common.Chain, kind common.AlertKind) bool {
+	return len(e.rulesOf(chain, kind)) > 0
+}
+
+// GetRules returns all rules from database.
+func (e *Engine) GetRules() ([]common.AlertRule, error) {
+	return e.db.GetAlertRules()
+}
+
+// CreateRule validates and saves a rule, it returns the rule with its id.
+func (e *Engine) CreateRule(rule common.AlertRule) (common.AlertRule, error) {
+	rule, err := e.validate(rule)
+	if err != nil {
+		return rule, err
+	}
+	rule, err = e.db.CreateAlertRule(rule)
+	if err != nil {
+		return rule, err
+	}
+	e.Reload()
+	return rule, nil
+}
+
+// UpdateRule validates and replaces the rule of the same id.
+func (e *Engine) UpdateRule(rule common.AlertRule) (common.AlertRule, error) {
+	rule, err := e.validate(rule)
+	if err != nil {
+		return rule, err
+	}
+	if err := e.db.UpdateAlertRule(rule); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return rule, ErrRuleNotFound
+		}
+		return rule, err
+	}
+	e.Reload()
+
+	rules, err := e.db.GetAlertRules()
+	if err != nil {
+		return rule, err
+	}
+	for _, r := range rules {
+		if r.ID == rule.ID {
+			return r, nil
+		}
+	}
+	return rule, ErrRuleNotFound
+}
+
+func (e *Engine) DeleteRule(id int64) error {
+	if err := e.db.DeleteAlertRule(id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return ErrRuleNotFound
+		}
+		return err
+	}
+	e.Reload()
+	return nil
+}
+
+func (e *Engine) validate(rule common.AlertRule) (common.AlertRule, error) {
+	rule, err := normalize(rule)
+	if err != nil {
+		return rule, err
+	}
+	if !e.storage.IsSupportedChain(rule.Chain) {
+		return rule, fmt.Errorf("%w: unsupported chain", ErrInvalidRule)
+	}
+	if rule.Kind == common.AlertKindCexInflow || rule.Kind == common.AlertKindNetFlowFlip {
+		// the duration must be a preset range or fit in the buckets
+		duration, _ := util.ParseDuration(rule.Duration)
+		if _, err := e.storage.GetTransferLogs(rule.Chain, duration); err != nil {
+			return rule, fmt.Errorf("%w: %s", ErrInvalidRule, err)
+		}
+	}
+	return rule, nil
+}
+
+// watchBigBuys sends the alerts of the big buys of chain until ctx is cancelled,
+// a subscription that is dropped for being slow is subscribed again.
+func (e *Engine) watchBigBuys(ctx context.Context, chain common.Chain) {
+	for {
+		sub, cancel := e.storage.SubscribeBigTx(storage.BigTxFilter{
+			Chain:  chain,
+			Action: common.SmartMoneyActivitiesBuying,
+		})
+		closed := false
+		for !closed {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case tx, ok := <-sub.C:
+				if !ok {
+					e.log.Warnw("big tx subscription is dropped, subscribe again", "chain", chain)
+					closed = true
+					continue
+				}
+				e.onBigBuy(chain, tx)
+			}
+		}
+		cancel()
+	}
+}
+
+func (e *Engine) onBigBuy(chain common.Chain, tx common.BigTx) {
+	if time.Since(tx.Time) > maxEventAge {
+		return
+	}
+	for _, rule := range e.rulesOf(chain, common.AlertKindBigBuy) {
+		if rule.Wallet != "" && common.AddressKey(rule.Wallet) != common.AddressKey(tx.Sender) {
+			continue
+		}
+		if rule.Token != "" && common.AddressKey(rule.Token) != common.AddressKey(tx.TokenAddress) {
+			continue
+		}
+		if tx.ValueInUsdt < rule.MinUsd {
+			continue
+		}
+		e.dispatcher.Send(rule, newAlert(rule, fmt.Sprintf("%s:%s", strings.ToLower(tx.Tx), strings.ToLower(tx.TokenAddress)),
+			tx.Time,
+			fmt.Sprintf("%s bought %.2f usd of %s", tx.Sender, tx.ValueInUsdt, tx.TokenAddress),
+			tx))
+	}
+}
+
+func (e *Engine) onPositionOpened(chain common.Chain, log common.Tradelog) {
+	rules := e.rulesOf(chain, common.AlertKindLeaderboardPosition)
+	if len(rules) == 0 {
+		return
+	}
+	ranks, err := e.leaderboard(chain)
+	if err != nil {
+		e.log.Errorw("error when get leaderboard", "chain", chain, "err", err)
+		return
+	}
+	rank, exist := ranks[common.AddressKey(log.Sender)]
+	if !exist {
+		return
+	}
+
+	valueInUsdt := log.TokenOutAmount * log.TokenOutUsdtRate
+	for _, rule := range rules {
+		if rank > rule.TopWallets || valueInUsdt < rule.MinUsd {
+			continue
+		}
+		e.dispatcher.Send(rule, newAlert(rule, logKey(log.TxHash, log.LogIndex), log.BlockTimestamp,
+			fmt.Sprintf("%s (rank %d) opened a position of %.2f usd in %s", log.Sender, rank, valueInUsdt, log.TokenOutAddress),
+			map[string]interface{}{
+				"wallet":        common.AddressKey(log.Sender),
+				"rank":          rank,
+				"token":         common.AddressKey(log.TokenOutAddress),
+				"amount":        log.TokenOutAmount,
+				"value_in_usdt": valueInUsdt,
+				"tx":            log.TxHash,
+				"block_number":  log.BlockNumber,
+			}))
+	}
+}
+
+// leaderboard returns the ranks of the wallets by profit in leaderboardDuration like the leaderboard api.
+func (e *Engine) leaderboard(chain common.Chain) (map[string]int, error) {
+	if l, exist := e.leaderboards[chain]; exist && time.Since(l.computedAt) < leaderboardCacheDuration {
+		return l.ranks, nil
+	}
+	tradeLogs, err := e.storage.GetTradeLogs(chain, leaderboardDuration)
+	if err != nil {
+		return nil, err
+	}
+	wallets := make([]string, 0, len(tradeLogs.UserProfit))
+	for wallet := range tradeLogs.UserProfit {
+		wallets = append(wallets, wallet)
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return tradeLogs.UserProfit[wallets[i]] > tradeLogs.UserProfit[wallets[j]]
+	})
+	ranks := make(map[string]int, len(wallets))
+	for i, wallet := range wallets {
+		ranks[common.AddressKey(wallet)] = i + 1
+	}
+	e.leaderboards[chain] = leaderboard{computedAt: time.Now(), ranks: ranks}
+	return ranks, nil
+}
+
+// evaluateFlows compares the cex inflow and net flow rules of chain with their previous values.
+func (e *Engine) evaluateFlows(chain common.Chain) {
+	now := time.Now()
+	inflows := e.rulesOf(chain, common.AlertKindCexInflow)
+	flips := e.rulesOf(chain, common.AlertKindNetFlowFlip)
+
+	active := make(map[int64]bool, len(inflows)+len(flips))
+	// the rules of the same window share the flows
+	inflowsByDuration := make(map[time.Duration]map[string]float64)
+	for _, rule := range inflows {
+		active[rule.ID] = true
+		duration, _ := util.ParseDuration(rule.Duration)
+		inflow, exist := inflowsByDuration[duration]
+		if !exist {
+			var err error
+			inflow, err = e.storage.GetCexInFlowInUsdt(chain, duration)
+			if err != nil {
+				e.log.Errorw("error when get cex inflow of alert rule", "rule", rule.ID, "err", err)
+				continue
+			}
+			inflowsByDuration[duration] = inflow
+		}
+		value := inflow[rule.Token]
+		prev, exist := e.flowState(rule)
+		e.flows[rule.ID] = flowState{rule: rule, value: value}
+		if !exist || prev >= rule.MinUsd || value < rule.MinUsd {
+			continue
+		}
+		e.dispatcher.Send(rule, newAlert(rule, fmt.Sprintf("%d", now.Unix()), now,
+			fmt.Sprintf("cex inflow of %s in %s is %.2f usd", rule.Token, rule.Duration, value),
+			map[string]interface{}{
+				"token":            rule.Token,
+				"duration":         rule.Duration,
+				"cex_in_flow_usdt": value,
+				"previous":         prev,
+			}))
+	}
+
+	type netFlowKey struct {
+		duration time.Duration
+		source   common.SourcePrice
+	}
+	netFlows := make(map[netFlowKey]map[string]float64)
+	for _, rule := range flips {
+		active[rule.ID] = true
+		duration, _ := util.ParseDuration(rule.Duration)
+		key := netFlowKey{duration: duration, source: rule.Source}
+		netFlow, exist := netFlows[key]
+		if !exist {
+			var err error
+			if netFlow, err = e.storage.GetTokenNetFlow(chain, duration, rule.Source); err != nil {
+				e.log.Errorw("error when get net flow of alert rule", "rule", rule.ID, "err", err)
+				continue
+			}
+			netFlows[key] = netFlow
+		}
+		value := netFlow[rule.Token]
+		if value == 0 {
+			// keep the sign of the last non zero flow
+			continue
+		}
+		prev, exist := e.flowState(rule)
+		e.flows[rule.ID] = flowState{rule: rule, value: value}
+		if !exist || prev*value > 0 || value > -rule.MinUsd && value < rule.MinUsd {
+			continue
+		}
+		e.dispatcher.Send(rule, newAlert(rule, fmt.Sprintf("%d", now.Unix()), now,
+			fmt.Sprintf("%s net flow of %s in %s flipped from %.2f to %.2f usd", rule.Source, rule.Token, rule.Duration, prev, value),
+			map[string]interface{}{
+				"token":         rule.Token,
+				"duration":      rule.Duration,
+				"source":        rule.Source,
+				"net_flow_usdt": value,
+				"previous":      prev,
+			}))
+	}
+
+	// drop the state of the deleted or disabled rules of chain
+	for id, state := range e.flows {
+		if state.rule.Chain == chain && !active[id] {
+			delete(e.flows, id)
+		}
+	}
+}
+
+// flowState returns the previous value of rule, a changed rule has no previous value.
+func (e *Engine) flowState(rule common.AlertRule) (float64, bool) {
+	state, exist := e.flows[rule.ID]
+	if !exist || !sameRule(state.rule, rule) {
+		return 0, false
+	}
+	return state.value, true
+}
+
+// logKey identifies a trade log.
+func logKey(txHash string, logIndex uint) string {
+	return fmt.Sprintf("%s:%d", strings.ToLower(txHash), logIndex)
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry keeps the state reported by the workers, the instance is ready when all components are ready.
+type Registry struct {
+	mutex      sync.RWMutex
+	components map[string]*Component
+}
+
+func NewRegistry() *Registry {
+	return &Registry{components: make(map[string]*Component)}
+}
+
+// Register adds a component that is stale if it has no success for maxAge,
+// and is behind if its lag is more than maxLag blocks, 0 to not check the lag.
+func (r *Registry) Register(name string, maxAge time.Duration, maxLag int64) *Component {
+	c := &Component{name: name, maxAge: maxAge, maxLag: maxLag}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.components[name] = c
+	return c
+}
+
+// Status is the state of a component at a time.
+type Status struct {
+	Name        string    `json:"name"`
+	Ready       bool      `json:"ready"`
+	Reason      string    `json:"reason,omitempty"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	LagBlocks   int64     `json:"lag_blocks,omitempty"`
+}
+
+// Statuses returns the status of all components by name and true if all of them are ready.
+func (r *Registry) Statuses(now time.Time) ([]Status, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	ready := true
+	res := make([]Status, 0, len(r.components))
+	for _, c := range r.components {
+		s := c.status(now)
+		ready = ready && s.Ready
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res, ready
+}
+
+// Component is the state of a worker, a nil component ignores the reports.
+type Component struct {
+	name   string
+	maxAge time.Duration
+	maxLag int64
+
+	mutex       sync.RWMutex
+	initialized bool
+	lastSuccess time.Time
+	lastError   string
+	lag         int64
+}
+
+// Initialized reports that the initial load is done, the component is not ready before.
+func (c *Component) Initialized() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.initialized = true
+}
+
+// Success reports a successful run.
+func (c *Component) Success() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lastSuccess = time.Now()
+	c.lastError = ""
+}
+
+// Failure reports a failed run, the component is ready until its last success is older than maxAge.
+func (c *Component) Failure(err error) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lastError = err.Error()
+}
+
+// SetLag reports the number of blocks behind the database.
+func (c *Component) SetLag(lag int64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lag = lag
+}
+
+func (c *Component) status(now time.Time) Status {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	s := Status{
+		Name:        c.name,
+		LastSuccess: c.lastSuccess,
+		LastError:   c.lastError,
+		LagBlocks:   c.lag,
+	}
+	switch {
+	case !c.initialized:
+		s.Reason = "initializing"
+	case now.Sub(c.lastSuccess) > c.maxAge:
+		s.Reason = "stale"
+	case c.maxLag > 0 && c.lag > c.maxLag:
+		s.Reason = "behind"
+	default:
+		s.Ready = true
+	}
+	return s
+}
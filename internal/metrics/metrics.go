@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "base_server"
+
+// kinds of logs
+const (
+	Trades    = "trades"
+	Transfers = "transfers"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the http requests by route and status code.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	ingestedLogs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingested_logs_total",
+		Help:      "Number of logs added to storage.",
+	}, []string{"chain", "kind"})
+
+	droppedLogs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_logs_total",
+		Help:      "Number of logs dropped because their rate couldn't be got.",
+	}, []string{"chain", "kind"})
+
+	lagBlocks = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingestion_lag_blocks",
+		Help:      "Number of blocks of the database that are not ingested yet.",
+	}, []string{"chain", "kind"})
+
+	rateFetchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_fetch_failures_total",
+		Help:      "Number of failures to get the rates from redis.",
+	}, []string{"chain"})
+
+	alertDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alert_deliveries_total",
+		Help:      "Number of alerts by delivery result.",
+	}, []string{"result"})
+)
+
+// results of the alert deliveries
+const (
+	AlertDelivered  = "delivered"
+	AlertFailed     = "failed"
+	AlertDuplicated = "duplicated"
+	AlertDropped    = "dropped"
+)
+
+// Middleware observes the duration of the requests by route, the unknown routes are grouped.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// AddLogs counts the logs of kind that are added or dropped by storage.
+func AddLogs(chain common.Chain, kind string, res storage.AddLogsResult) {
+	ingestedLogs.WithLabelValues(chain.String(), kind).Add(float64(res.Added))
+	droppedLogs.WithLabelValues(chain.String(), kind).Add(float64(res.Dropped))
+}
+
+// SetLag sets the number of blocks of kind behind the database.
+func SetLag(chain common.Chain, kind string, lag int64) {
+	lagBlocks.WithLabelValues(chain.String(), kind).Set(float64(lag))
+}
+
+// RateFetchFailed counts a failure to get the rates of chain.
+func RateFetchFailed(chain common.Chain) {
+	rateFetchFailures.WithLabelValues(chain.String()).Inc()
+}
+
+// DeliverAlert counts an alert by its delivery result.
+func DeliverAlert(result string) {
+	alertDeliveries.WithLabelValues(result).Inc()
+}
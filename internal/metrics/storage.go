@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tradeLogsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage", "trade_logs"),
+		"Number of trade logs in memory.", []string{"chain"}, nil)
+	transferLogsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage", "transfer_logs"),
+		"Number of transfer logs in memory.", []string{"chain"}, nil)
+	bigTxsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "storage", "big_txs"),
+		"Number of big transactions in memory.", []string{"chain"}, nil)
+)
+
+// storageCollector reads the sizes of storage on scrape.
+type storageCollector struct {
+	storage *storage.Storage
+}
+
+// RegisterStorage exposes the sizes of the logs and big transactions of each chain of storage.
+func RegisterStorage(storage *storage.Storage) {
+	prometheus.MustRegister(&storageCollector{storage: storage})
+}
+
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tradeLogsDesc
+	ch <- transferLogsDesc
+	ch <- bigTxsDesc
+}
+
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, chain := range c.storage.GetChains() {
+		sizes := c.storage.GetSizes(chain)
+		ch <- prometheus.MustNewConstMetric(tradeLogsDesc, prometheus.GaugeValue, float64(sizes.TradeLogs), chain.String())
+		ch <- prometheus.MustNewConstMetric(transferLogsDesc, prometheus.GaugeValue, float64(sizes.TransferLogs), chain.String())
+		ch <- prometheus.MustNewConstMetric(bigTxsDesc, prometheus.GaugeValue, float64(sizes.BigTxs), chain.String())
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/common/utils"
+)
+
+// adminAuth aborts the request if it doesn't have the admin bearer token.
+func (s *Server) adminAuth(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthorized.Error()})
+		return
+	}
+	c.Next()
+}
+
+type GetBigTxThresholdRequest struct {
+	Chain string `form:"chain" binding:"required"`
+}
+
+func (s *Server) getBigTxThreshold(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetBigTxThresholdRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get big tx threshold", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidBigTxThreshold.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get big tx threshold", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidBigTxThreshold.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"threshold": s.storage.GetBigTxThreshold(chain),
+	})
+}
+
+type SetBigTxThresholdRequest struct {
+	Chain     string                `json:"chain" binding:"required"`
+	Threshold common.BigTxThreshold `json:"threshold"`
+}
+
+func (s *Server) setBigTxThreshold(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request SetBigTxThresholdRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when set big tx threshold", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidBigTxThreshold.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when set big tx threshold", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidBigTxThreshold.Error()})
+		return
+	}
+
+	if err := s.storage.SetBigTxThreshold(chain, request.Threshold); err != nil {
+		log.Errorw("invalid big tx threshold", "chain", chain, "threshold", request.Threshold, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Infow("set big tx threshold", "chain", chain, "threshold", request.Threshold)
+
+	c.JSON(http.StatusOK, gin.H{
+		"threshold": s.storage.GetBigTxThreshold(chain),
+	})
+}
+
+type PutSnapshotRequest struct {
+	Chain string `form:"chain" binding:"required"`
+}
+
+// putSnapshot queues the snapshot in the body, e.g. from the backfill command. It replaces the data of the chain
+// on the next poll of the ingestion worker, then the blocks after the snapshot are ingested again.
+// The body is limited to maxSnapshotBytes.
+func (s *Server) putSnapshot(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request PutSnapshotRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when put snapshot", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidSnapshot.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when put snapshot", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidSnapshot.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, s.maxSnapshotBytes)
+	blocks, err := s.storage.QueueSnapshot(chain, body)
+	if err != nil {
+		log.Errorw("invalid snapshot", "chain", chain, "err", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Infow("queue snapshot", "chain", chain, "blocks", blocks)
+
+	c.JSON(http.StatusOK, gin.H{
+		"last_trade_block":    blocks.LastTradeBlock,
+		"last_transfer_block": blocks.LastTransferBlock,
+	})
+}
+
+type GetLabelsRequest struct {
+	Chain string `form:"chain" binding:"required"`
+}
+
+func (s *Server) getLabels(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetLabelsRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get labels", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLabel.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get labels", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLabel.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"labels": s.labels.GetLabels(chain),
+	})
+}
+
+// putLabel adds or replaces the label of an address, the labels are reset to the labels file on restart.
+func (s *Server) putLabel(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request common.WalletLabel
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when put label", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLabel.Error()})
+		return
+	}
+
+	if _, err := s.parseChain(request.Chain.String()); err != nil {
+		log.Errorw("invalid request when put label", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLabel.Error()})
+		return
+	}
+
+	if err := s.labels.Set(request); err != nil {
+		log.Errorw("invalid label", "label", request, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Infow("put label", "label", request)
+
+	label, _ := s.labels.Get(request.Chain, request.Address)
+	c.JSON(http.StatusOK, gin.H{
+		"label": label,
+	})
+}
+
+type DeleteLabelRequest struct {
+	Chain   string `form:"chain" binding:"required"`
+	Address string `form:"address" binding:"required"`
+}
+
+func (s *Server) deleteLabel(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request DeleteLabelRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when delete label", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLabel.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when delete label", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLabel.Error()})
+		return
+	}
+
+	if !s.labels.Remove(chain, request.Address) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrLabelNotFound.Error()})
+		return
+	}
+	log.Infow("delete label", "chain", chain, "address", request.Address)
+
+	c.JSON(http.StatusOK, gin.H{
+		"address": common.AddressKey(request.Address),
+	})
+}
+
+type GetQuoteTokensRequest struct {
+	Chain string `form:"chain" binding:"required"`
+}
+
+func (s *Server) getQuoteTokens(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetQuoteTokensRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get quote tokens", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidQuoteToken.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get quote tokens", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidQuoteToken.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quote_tokens": s.storage.GetQuoteTokens(chain),
+	})
+}
+
+type PutQuoteTokenRequest struct {
+	Chain string `json:"chain" binding:"required"`
+	common.QuoteToken
+}
+
+// putQuoteToken adds or replaces a quote token of a chain, the quote tokens are reset to the chain config on restart.
+func (s *Server) putQuoteToken(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request PutQuoteTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when put quote token", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidQuoteToken.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when put quote token", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidQuoteToken.Error()})
+		return
+	}
+
+	if err := s.storage.SetQuoteToken(chain, request.QuoteToken); err != nil {
+		log.Errorw("invalid quote token", "token", request.QuoteToken, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Infow("put quote token", "chain", chain, "token", request.QuoteToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"quote_tokens": s.storage.GetQuoteTokens(chain),
+	})
+}
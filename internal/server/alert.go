@@ -0,0 +1,141 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/alert"
+	"github.com/kv-base-hack/common/utils"
+	"go.uber.org/zap"
+)
+
+// maskedSecret replaces the secret of the rules in the responses
+const maskedSecret = "********"
+
+func alertRuleResponse(rule common.AlertRule) common.AlertRule {
+	if rule.Secret != "" {
+		rule.Secret = maskedSecret
+	}
+	return rule
+}
+
+func (s *Server) getAlertRules(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	rules, err := s.alerts.GetRules()
+	if err != nil {
+		log.Errorw("error when get alert rules", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := make([]common.AlertRule, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, alertRuleResponse(rule))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"rules": res,
+	})
+}
+
+// createAlertRule adds a rule, it is enabled if enabled is not set.
+func (s *Server) createAlertRule(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	request := common.AlertRule{Enabled: true}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when create alert rule", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidAlertRule.Error()})
+		return
+	}
+
+	rule, err := s.alerts.CreateRule(request)
+	if err != nil {
+		s.alertRuleError(c, log, "create", err)
+		return
+	}
+	log.Infow("create alert rule", "id", rule.ID, "name", rule.Name, "kind", rule.Kind)
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule": alertRuleResponse(rule),
+	})
+}
+
+// updateAlertRule replaces the rule of the id in the path, the masked secret of the responses keeps the secret.
+func (s *Server) updateAlertRule(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Errorw("invalid id when update alert rule", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidAlertRule.Error()})
+		return
+	}
+
+	var request common.AlertRule
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when update alert rule", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidAlertRule.Error()})
+		return
+	}
+	request.ID = id
+	if request.Secret == maskedSecret {
+		rules, err := s.alerts.GetRules()
+		if err != nil {
+			s.alertRuleError(c, log, "update", err)
+			return
+		}
+		for _, rule := range rules {
+			if rule.ID == id {
+				request.Secret = rule.Secret
+			}
+		}
+	}
+
+	rule, err := s.alerts.UpdateRule(request)
+	if err != nil {
+		s.alertRuleError(c, log, "update", err)
+		return
+	}
+	log.Infow("update alert rule", "id", rule.ID, "name", rule.Name, "kind", rule.Kind)
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule": alertRuleResponse(rule),
+	})
+}
+
+func (s *Server) deleteAlertRule(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Errorw("invalid id when delete alert rule", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidAlertRule.Error()})
+		return
+	}
+
+	if err := s.alerts.DeleteRule(id); err != nil {
+		s.alertRuleError(c, log, "delete", err)
+		return
+	}
+	log.Infow("delete alert rule", "id", id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id": id,
+	})
+}
+
+func (s *Server) alertRuleError(c *gin.Context, log *zap.SugaredLogger, action string, err error) {
+	log.Errorw("error when "+action+" alert rule", "err", err)
+	switch {
+	case errors.Is(err, alert.ErrInvalidRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, alert.ErrRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+)
+
+// Cursor is the position of the last item of a page, clients get it as an opaque string.
+type Cursor struct {
+	// Value is the sort value of the lists that are ordered by value
+	Value cursorValue `json:"v,omitempty"`
+	// Block is the block number of the lists that are ordered by block
+	Block uint64 `json:"b,omitempty"`
+	// Key is the address or tx of the item, it breaks the ties
+	Key string `json:"k"`
+}
+
+func (c Cursor) String() string {
+	// all fields are encodable, Value is a string
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorValue is encoded as a string by strconv, json can't encode the NaN and Inf values.
+type cursorValue float64
+
+func (v cursorValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatFloat(float64(v), 'g', -1, 64))
+}
+
+func (v *cursorValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v = cursorValue(f)
+	return nil
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Key == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Pagination is the query of the list endpoints. The page starts after Cursor if it is set,
+// else it is the page Start of size Limit. start/limit pages shift when new logs arrive.
+type Pagination struct {
+	Start  int    `form:"start" binding:"omitempty,numeric,min=1"`
+	Limit  int    `form:"limit" binding:"required,numeric,min=1"`
+	Cursor string `form:"cursor"`
+}
+
+func (p Pagination) offset() int {
+	if p.Start == 0 {
+		return 0
+	}
+	return (p.Start - 1) * p.Limit
+}
+
+// sortValue returns the value to sort by, NaN is not ordered so it is sorted as -Inf.
+func sortValue(v float64) float64 {
+	if math.IsNaN(v) {
+		return math.Inf(-1)
+	}
+	return v
+}
+
+// sortData sorts by value desc then key, so the order is the same between requests.
+func sortData(data []Data) {
+	sort.Slice(data, func(i, j int) bool {
+		vi, vj := sortValue(data[i].value), sortValue(data[j].value)
+		if vi != vj {
+			return vi > vj
+		}
+		return data[i].key < data[j].key
+	})
+}
+
+// dataPage sorts data and returns the items of the page and the cursor of the next page,
+// the cursor is empty if it is the last page.
+func (p Pagination) dataPage(data []Data) ([]Data, string, error) {
+	sortData(data)
+
+	st := p.offset()
+	if p.Cursor != "" {
+		c, err := ParseCursor(p.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		value := sortValue(float64(c.Value))
+		st = sort.Search(len(data), func(i int) bool {
+			v := sortValue(data[i].value)
+			return v < value || (v == value && data[i].key > c.Key)
+		})
+	}
+	if st > len(data) {
+		st = len(data)
+	}
+	ed := st + p.Limit
+	if ed > len(data) {
+		ed = len(data)
+	}
+
+	var next string
+	if ed > st && ed < len(data) {
+		next = Cursor{Value: cursorValue(data[ed-1].value), Key: data[ed-1].key}.String()
+	}
+	return data[st:ed], next, nil
+}
+
+// bigTxPage returns the big transactions of the page, the total and the cursor of the next page.
+// fetch returns up to last latest big transactions before the cursor and the total.
+func (p Pagination) bigTxPage(fetch func(last int, before storage.BigTxCursor) ([]common.BigTx, int)) ([]common.BigTx, int, string, error) {
+	var (
+		txs   []common.BigTx
+		total int
+	)
+	if p.Cursor != "" {
+		c, err := ParseCursor(p.Cursor)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		// one more to know if there is a next page
+		txs, total = fetch(p.Limit+1, storage.BigTxCursor{Block: c.Block, Key: c.Key})
+	} else {
+		txs, total = fetch(p.offset()+p.Limit+1, storage.BigTxCursor{})
+		if p.offset() < len(txs) {
+			txs = txs[p.offset():]
+		} else {
+			txs = nil
+		}
+	}
+
+	var next string
+	if len(txs) > p.Limit {
+		txs = txs[:p.Limit]
+		last := txs[len(txs)-1]
+		next = Cursor{Block: last.BlockNumber, Key: storage.BigTxKey(last)}.String()
+	}
+	return txs, total, next, nil
+}
@@ -7,11 +7,14 @@ var (
 	ErrInvalidTopCexOutRequest      = errors.New("invalid cex out request")
 	ErrInvalidTopNetInRequest       = errors.New("invalid net in request")
 	ErrInvalidTopNetOutRequest      = errors.New("invalid net out request")
+	ErrInvalidTopExchangesRequest   = errors.New("invalid top exchanges request")
 	ErrInvalidTopUserProfitRequest  = errors.New("invalid user profit request")
 	ErrInvalidTopTokenProfitRequest = errors.New("invalid token profit request")
 	ErrInvalidTokenInspect          = errors.New("invalid token inspect")
 	ErrInvalidUserInspect           = errors.New("invalid user inspect")
 	ErrInvalidDuration              = errors.New("invalid duration")
+	ErrDurationOfPnlSort            = errors.New("duration is not supported by the pnl sorts, the pnl is all time")
+	ErrInvalidCursor                = errors.New("invalid cursor")
 
 	ErrInvalidListToken     = errors.New("invalid get list token")
 	ErrInvalidListUser      = errors.New("invalid get list user")
@@ -20,4 +23,15 @@ var (
 	ErrInvalidGetLeaderboard  = errors.New("invalid get leaderboard")
 	ErrInvalidGetUserBalances = errors.New("invalid get user balances")
 	ErrInvalidGetTokenInfo    = errors.New("invalid get token info")
+	ErrInvalidGetTokenCandles = errors.New("invalid get token candles")
+
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrInvalidBigTxThreshold = errors.New("invalid big tx threshold")
+	ErrInvalidSnapshot       = errors.New("invalid snapshot")
+	ErrInvalidLabel          = errors.New("invalid label")
+	ErrLabelNotFound         = errors.New("label not found")
+	ErrInvalidQuoteToken     = errors.New("invalid quote token")
+	ErrInvalidAlertRule      = errors.New("invalid alert rule")
+	ErrInvalidWatchlist      = errors.New("invalid watchlist")
+	ErrWatchlistNotFound     = errors.New("watchlist not found")
 )
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/util"
+	"github.com/kv-base-hack/common/utils"
+)
+
+type ExchangeFlowResponse struct {
+	Exchange      string  `json:"exchange"`
+	InFlow        float64 `json:"in_flow,omitempty"`
+	InFlowInUsdt  float64 `json:"in_flow_in_usdt"`
+	OutFlow       float64 `json:"out_flow,omitempty"`
+	OutFlowInUsdt float64 `json:"out_flow_in_usdt"`
+	NetFlowInUsdt float64 `json:"net_flow_in_usdt"`
+}
+
+func newExchangeFlowResponse(f storage.ExchangeFlow) ExchangeFlowResponse {
+	return ExchangeFlowResponse{
+		Exchange:      f.Exchange,
+		InFlow:        f.In,
+		InFlowInUsdt:  f.InInUsdt,
+		OutFlow:       f.Out,
+		OutFlowInUsdt: f.OutInUsdt,
+		NetFlowInUsdt: f.NetInUsdt(),
+	}
+}
+
+type TopExchangesRequest struct {
+	Duration string `form:"duration" binding:"required"`
+	// only the flows of this token, all tokens if empty
+	Token string `form:"token"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
+}
+
+// getTopExchanges returns the exchanges ordered by net flow in usdt, the highest net inflow first.
+func (s *Server) getTopExchanges(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+	now := time.Now()
+	defer func() {
+		log.Debugw("Execution time", "getTopExchanges", time.Since(now))
+	}()
+
+	var request TopExchangesRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get top exchanges", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopExchangesRequest.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get top exchanges", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopExchangesRequest.Error()})
+		return
+	}
+
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get top exchanges", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	flows, err := s.storage.GetExchangeFlows(chain, duration, request.Token)
+	if err != nil {
+		log.Errorw("invalid duration when get top exchanges", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	byExchange := make(map[string]storage.ExchangeFlow, len(flows))
+	arrData := make([]Data, 0, len(flows))
+	for _, f := range flows {
+		byExchange[f.Exchange] = f
+		arrData = append(arrData, Data{key: f.Exchange, value: f.NetInUsdt()})
+	}
+
+	page, next, err := request.dataPage(arrData)
+	if err != nil {
+		log.Errorw("invalid cursor when get top exchanges", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	top := make([]ExchangeFlowResponse, 0, len(page))
+	for _, d := range page {
+		top = append(top, newExchangeFlowResponse(byExchange[d.key]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"top_exchanges": top,
+		"next_cursor":   next,
+		"total":         len(flows),
+	})
+}
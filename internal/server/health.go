@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getHealth returns 200 while the server is up, with the status of the workers.
+func (s *Server) getHealth(c *gin.Context) {
+	statuses, ready := s.health.Statuses(time.Now())
+	c.JSON(http.StatusOK, gin.H{
+		"ready":      ready,
+		"components": statuses,
+	})
+}
+
+// getReady returns 503 until all workers are initialized, up to date and caught up with the database.
+func (s *Server) getReady(c *gin.Context) {
+	statuses, ready := s.health.Statuses(time.Now())
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"ready":      ready,
+		"components": statuses,
+	})
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/util"
+	"github.com/kv-base-hack/common/utils"
+)
+
+type TopNetFlowRequest struct {
+	Duration string `form:"duration" binding:"required"`
+	// cex ranks by cex in flow - cex out flow, dex by dex buy - dex sell
+	Source string `form:"source" binding:"required"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
+}
+
+// getTopNetIn returns the tokens with the highest positive net flow.
+func (s *Server) getTopNetIn(c *gin.Context) {
+	s.getTopNetFlow(c, "top_net_in", 1, ErrInvalidTopNetInRequest)
+}
+
+// getTopNetOut returns the tokens with the highest negative net flow, the value is the net out flow.
+func (s *Server) getTopNetOut(c *gin.Context) {
+	s.getTopNetFlow(c, "top_net_out", -1, ErrInvalidTopNetOutRequest)
+}
+
+// getTopNetFlow returns the tokens whose net flow multiplied by sign is positive, ordered by this value, in key.
+func (s *Server) getTopNetFlow(c *gin.Context, key string, sign float64, errInvalid error) {
+	log := s.log.With("ID", utils.RandomString(29))
+	now := time.Now()
+	defer func() {
+		log.Debugw("Execution time", key, time.Since(now))
+	}()
+
+	var request TopNetFlowRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get top net flow", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalid.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get top net flow", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		return
+	}
+
+	source, err := common.SourcePriceString(request.Source)
+	if err != nil {
+		log.Errorw("invalid source when get top net flow", "source", request.Source, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalid.Error()})
+		return
+	}
+
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get top net flow", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	netFlow, err := s.storage.GetTokenNetFlow(chain, duration, source)
+	if err != nil {
+		log.Errorw("invalid duration when get top net flow", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := make(map[string]float64, len(netFlow))
+	for token, v := range netFlow {
+		if v*sign > 0 {
+			data[token] = v * sign
+		}
+	}
+
+	addrToTokenInfo := s.storage.GetTokenInfo(chain)
+	top, next, err := s.getTopToken(chain, data, addrToTokenInfo, request.Pagination)
+	if err != nil {
+		log.Errorw("invalid cursor when get top net flow", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		key:           top,
+		"next_cursor": next,
+		"total":       len(data),
+	})
+}
@@ -1,24 +1,26 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"sort"
-	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/alert"
+	"github.com/kv-base-hack/base-server-api/internal/health"
+	"github.com/kv-base-hack/base-server-api/internal/metrics"
 	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/storage/db"
 	"github.com/kv-base-hack/base-server-api/util"
 	inmem "github.com/kv-base-hack/common/inmem_db"
 	"github.com/kv-base-hack/common/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
-const defaultLength = 100
-
 // Server to serve the service.
 type Server struct {
 	s        *gin.Engine
@@ -26,13 +28,26 @@ type Server struct {
 	log      *zap.SugaredLogger
 	storage  *storage.Storage
 	inMemDB  inmem.Inmem
+	// the admin api is disabled if adminToken is empty
+	adminToken string
+	// maximum size of the body of putSnapshot
+	maxSnapshotBytes int64
+	// closed on shutdown to end the streams, they would block the drain of the requests
+	shutdown chan struct{}
+	health   *health.Registry
+	labels   *util.LabelRegistry
+	alerts   *alert.Engine
+	// the watchlists are stored in database
+	watchlists db.WatchlistStore
 }
 
 // New returns a new server.
-func NewServer(bindAddr string, storage *storage.Storage, inMemDB inmem.Inmem) *Server {
+func NewServer(bindAddr string, storage *storage.Storage, inMemDB inmem.Inmem, adminToken string, maxSnapshotBytes int64,
+	health *health.Registry, labels *util.LabelRegistry, alerts *alert.Engine, watchlists db.WatchlistStore) *Server {
 	engine := gin.New()
 
 	engine.Use(gin.Recovery())
+	engine.Use(metrics.Middleware())
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"}
@@ -47,6 +62,14 @@ func NewServer(bindAddr string, storage *storage.Storage, inMemDB inmem.Inmem) *
 		bindAddr: bindAddr,
 		storage:  storage,
 		inMemDB:  inMemDB,
+
+		adminToken:       adminToken,
+		maxSnapshotBytes: maxSnapshotBytes,
+		shutdown:         make(chan struct{}),
+		health:           health,
+		labels:           labels,
+		alerts:           alerts,
+		watchlists:       watchlists,
 	}
 
 	gin.SetMode(gin.DebugMode)
@@ -55,22 +78,51 @@ func NewServer(bindAddr string, storage *storage.Storage, inMemDB inmem.Inmem) *
 	return s
 }
 
-// Run runs server.
-func (s *Server) Run() error {
+// Run runs server until ctx is cancelled, then it waits up to shutdownTimeout for the in-flight requests.
+func (s *Server) Run(ctx context.Context, shutdownTimeout time.Duration) error {
 	s.log.Debugw("run in ", "s.bindAddr", s.bindAddr)
-	if err := s.s.Run(s.bindAddr); err != nil {
+	srv := &http.Server{
+		Addr:    s.bindAddr,
+		Handler: s.s,
+	}
+	srv.RegisterOnShutdown(func() {
+		close(s.shutdown)
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
 		return fmt.Errorf("run server: %w", err)
+	case <-ctx.Done():
+	}
+
+	s.log.Infow("shutdown server", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown server: %w", err)
 	}
 	return nil
 }
 
 func (s *Server) register() {
 	s.s.GET("/debug/pprof/*all", gin.WrapH(http.DefaultServeMux))
+	s.s.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	s.s.GET("/healthz", s.getHealth)
+	s.s.GET("/readyz", s.getReady)
 	v1 := s.s.Group("/v1")
 
 	v1.GET("/token_cex_in", s.getTopCexIn)
 	v1.GET("/token_cex_out", s.getTopCexOut)
+	v1.GET("/token_net_in", s.getTopNetIn)
+	v1.GET("/token_net_out", s.getTopNetOut)
+	v1.GET("/top_exchanges", s.getTopExchanges)
 	v1.GET("/activities", s.getActivities)
+	v1.GET("/activities/stream", s.getActivitiesStream)
 	v1.GET("/leaderboard", s.getLeaderboard)
 
 	token := v1.Group("token")
@@ -82,6 +134,7 @@ func (s *Server) register() {
 	token.GET("/trending", s.getTokenTrending)
 	token.GET("/info", s.getTokenInfo)
 	token.GET("/price_with_transfer", s.getPriceWithTransfer)
+	token.GET("/candles", s.getTokenCandles)
 
 	user := v1.Group("user")
 	user.GET("/profit", s.getUserProfit)
@@ -89,6 +142,44 @@ func (s *Server) register() {
 	user.GET("/inspect/activities", s.userInspectActivities)
 	user.GET("/balances", s.getUserBalances)
 	user.GET("/portfolio", s.getUserPortfolio)
+
+	watchlists := v1.Group("watchlists")
+	watchlists.GET("", s.listWatchlists)
+	watchlists.GET("/:id", s.getWatchlist)
+	watchlists.GET("/:id/activities", s.getWatchlistActivities)
+	watchlists.GET("/:id/pnl", s.getWatchlistPnl)
+	watchlists.GET("/:id/flows", s.getWatchlistFlows)
+
+	if s.adminToken != "" {
+		admin := s.s.Group("/admin", s.adminAuth)
+		admin.GET("/big_tx_threshold", s.getBigTxThreshold)
+		admin.PUT("/big_tx_threshold", s.setBigTxThreshold)
+		admin.PUT("/snapshot", s.putSnapshot)
+		admin.GET("/labels", s.getLabels)
+		admin.PUT("/labels", s.putLabel)
+		admin.DELETE("/labels", s.deleteLabel)
+		admin.GET("/quote_tokens", s.getQuoteTokens)
+		admin.PUT("/quote_tokens", s.putQuoteToken)
+		admin.GET("/alerts", s.getAlertRules)
+		admin.POST("/alerts", s.createAlertRule)
+		admin.PUT("/alerts/:id", s.updateAlertRule)
+		admin.DELETE("/alerts/:id", s.deleteAlertRule)
+		admin.POST("/watchlists", s.createWatchlist)
+		admin.PUT("/watchlists/:id", s.updateWatchlist)
+		admin.DELETE("/watchlists/:id", s.deleteWatchlist)
+	}
+}
+
+// parseChain returns the chain of the request if it is served by this server.
+func (s *Server) parseChain(chain string) (common.Chain, error) {
+	c, err := common.ChainString(chain)
+	if err != nil {
+		return 0, err
+	}
+	if !s.storage.IsSupportedChain(c) {
+		return 0, fmt.Errorf("chain %s is not supported", chain)
+	}
+	return c, nil
 }
 
 type AddressResponse struct {
@@ -106,14 +197,24 @@ type TokenAddressResponse struct {
 
 type UserAddressResponse struct {
 	AddressResponse
-	Name string `json:"name,omitempty"`
+	Name     string               `json:"name,omitempty"`
+	Category common.LabelCategory `json:"category,omitempty"`
+}
+
+// userAddressResponse returns the address with its label.
+func (s *Server) userAddressResponse(chain common.Chain, address AddressResponse) UserAddressResponse {
+	label, _ := s.labels.Get(chain, address.Addr)
+	return UserAddressResponse{
+		AddressResponse: address,
+		Name:            label.Name,
+		Category:        label.Category,
+	}
 }
 
 type TopCexInRequest struct {
-	Duration time.Duration `form:"duration" binding:"required"`
-	Start    int           `form:"start" binding:"required,numeric,min=1"`
-	Limit    int           `form:"limit" binding:"required,numeric,min=1"`
-	Chain    string        `form:"chain" binding:"required"`
+	Duration string `form:"duration" binding:"required"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
 }
 
 type Data struct {
@@ -121,8 +222,9 @@ type Data struct {
 	value float64
 }
 
+// getTopToken returns the page of tokens ordered by value and the cursor of the next page.
 func (s *Server) getTopToken(chain common.Chain, data map[string]float64,
-	addrToTokenInfo map[string]common.Token, start, limit int) []TokenAddressResponse {
+	addrToTokenInfo map[string]common.Token, p Pagination) ([]TokenAddressResponse, string, error) {
 	arrData := []Data{}
 
 	for k, v := range data {
@@ -132,19 +234,14 @@ func (s *Server) getTopToken(chain common.Chain, data map[string]float64,
 		})
 	}
 
-	sort.Slice(arrData, func(i, j int) bool {
-		return arrData[i].value > arrData[j].value
-	})
+	page, next, err := p.dataPage(arrData)
+	if err != nil {
+		return nil, "", err
+	}
 
 	top := make([]TokenAddressResponse, 0)
-	st := (start - 1) * limit
-	ed := st + limit - 1
-	for i := st; i <= ed; i++ {
-		if i >= len(arrData) {
-			break
-		}
-		t := arrData[i]
-		info := addrToTokenInfo[strings.ToLower(t.key)]
+	for _, t := range page {
+		info := addrToTokenInfo[common.AddressKey(t.key)]
 		top = append(top, TokenAddressResponse{
 			AddressResponse: AddressResponse{
 				Addr:  t.key,
@@ -156,7 +253,7 @@ func (s *Server) getTopToken(chain common.Chain, data map[string]float64,
 			ImageUrl:     info.ImageUrl,
 		})
 	}
-	return top
+	return top, next, nil
 }
 
 func (s *Server) getTopCexIn(c *gin.Context) {
@@ -173,14 +270,21 @@ func (s *Server) getTopCexIn(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get top cex in", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	transferLogs, err := s.storage.GetTransferLogs(chain, request.Duration)
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get top cex in", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	transferLogs, err := s.storage.GetTransferLogs(chain, duration)
 	if err != nil {
 		log.Errorw("invalid duration when get top cex in", "duration", request.Duration, "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -192,19 +296,24 @@ func (s *Server) getTopCexIn(c *gin.Context) {
 		"transferBlockTs", transferLogs.StorageByRangeIndex)
 
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
-	topCexIn := s.getTopToken(chain, transferLogs.CexInFlowInUsdt, addrToTokenInfo, request.Start, request.Limit)
+	topCexIn, next, err := s.getTopToken(chain, transferLogs.CexInFlowInUsdt, addrToTokenInfo, request.Pagination)
+	if err != nil {
+		log.Errorw("invalid cursor when get top cex in", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"top_cex_in": topCexIn,
-		"total":      len(transferLogs.CexInFlowInUsdt),
+		"top_cex_in":  topCexIn,
+		"next_cursor": next,
+		"total":       len(transferLogs.CexInFlowInUsdt),
 	})
 }
 
 type TopCexOutRequest struct {
-	Duration time.Duration `form:"duration" binding:"required"`
-	Start    int           `form:"start" binding:"required,numeric,min=1"`
-	Limit    int           `form:"limit" binding:"required,numeric,min=1"`
-	Chain    string        `form:"chain" binding:"required"`
+	Duration string `form:"duration" binding:"required"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
 }
 
 func (s *Server) getTopCexOut(c *gin.Context) {
@@ -221,14 +330,21 @@ func (s *Server) getTopCexOut(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get top cex in", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	transferLogs, err := s.storage.GetTransferLogs(chain, request.Duration)
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get top cex out", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	transferLogs, err := s.storage.GetTransferLogs(chain, duration)
 	if err != nil {
 		log.Errorw("invalid duration when get top cex out", "duration", request.Duration, "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -240,19 +356,24 @@ func (s *Server) getTopCexOut(c *gin.Context) {
 		"transferBlockTs", transferLogs.StorageByRangeIndex)
 
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
-	topCexOut := s.getTopToken(chain, transferLogs.CexOutFlowInUsdt, addrToTokenInfo, request.Start, request.Limit)
+	topCexOut, next, err := s.getTopToken(chain, transferLogs.CexOutFlowInUsdt, addrToTokenInfo, request.Pagination)
+	if err != nil {
+		log.Errorw("invalid cursor when get top cex out", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"top_cex_out": topCexOut,
+		"next_cursor": next,
 		"total":       len(transferLogs.CexOutFlowInUsdt),
 	})
 }
 
 type GetActivitiesRequest struct {
 	Action string `form:"action" binding:"required"`
-	Start  int    `form:"start" binding:"required,numeric,min=1"`
-	Limit  int    `form:"limit" binding:"required,numeric,min=1"`
-	Chain  string `form:"chain" binding:"required"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
 }
 
 type GetActivitiesResponse struct {
@@ -260,6 +381,30 @@ type GetActivitiesResponse struct {
 	TokenSymbol   string `json:"symbol"`
 	TokenImageUrl string `json:"token_image_url"`
 	ChainID       string `json:"chain_id"`
+
+	SenderName           string               `json:"sender_name,omitempty"`
+	SenderCategory       common.LabelCategory `json:"sender_category,omitempty"`
+	CounterpartyName     string               `json:"counterparty_name,omitempty"`
+	CounterpartyCategory common.LabelCategory `json:"counterparty_category,omitempty"`
+}
+
+// activityResponse returns the big transaction with the token info and the labels of the sender and counterparty.
+func (s *Server) activityResponse(chain common.Chain, tx common.BigTx, info common.Token) GetActivitiesResponse {
+	res := GetActivitiesResponse{
+		BigTx:         tx,
+		TokenSymbol:   info.Symbol,
+		TokenImageUrl: info.ImageUrl,
+		ChainID:       info.ChainID,
+	}
+	if l, exist := s.labels.Get(chain, tx.Sender); exist {
+		res.SenderName, res.SenderCategory = l.Name, l.Category
+	}
+	if tx.Counterparty != "" {
+		if l, exist := s.labels.Get(chain, tx.Counterparty); exist {
+			res.CounterpartyName, res.CounterpartyCategory = l.Name, l.Category
+		}
+	}
+	return res
 }
 
 func (s *Server) getActivities(c *gin.Context) {
@@ -276,7 +421,7 @@ func (s *Server) getActivities(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get list user", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
@@ -291,45 +436,40 @@ func (s *Server) getActivities(c *gin.Context) {
 	}
 
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
-	activities := s.storage.GetLastBigTx(chain, action, defaultLength)
+	activities, total, next, err := request.bigTxPage(func(last int, before storage.BigTxCursor) ([]common.BigTx, int) {
+		return s.storage.GetLastBigTx(chain, action, last, before)
+	})
 	if err != nil {
-		log.Errorw("invalid request when get list user", "err", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		log.Errorw("invalid cursor when get activities", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	act := []GetActivitiesResponse{}
-	st := (request.Start - 1) * request.Limit
-	ed := st + request.Limit - 1
-
-	for i := st; i <= ed; i++ {
-		if i >= len(activities) {
-			break
-		}
-		a := activities[i]
-		info := addrToTokenInfo[strings.ToLower(a.TokenAddress)]
-		act = append(act, GetActivitiesResponse{
-			BigTx:         a,
-			TokenSymbol:   info.Symbol,
-			TokenImageUrl: info.ImageUrl,
-			ChainID:       info.ChainID,
-		})
+	for _, a := range activities {
+		info := addrToTokenInfo[common.AddressKey(a.TokenAddress)]
+		act = append(act, s.activityResponse(chain, a, info))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"activities": act,
-		"total":      len(activities),
+		"activities":  act,
+		"next_cursor": next,
+		"total":       total,
 	})
 }
 
 type GetLeaderboardRequest struct {
-	Start int    `form:"start" binding:"required,numeric,min=1"`
-	Limit int    `form:"limit" binding:"required,numeric,min=1"`
+	Pagination
 	Chain string `form:"chain" binding:"required"`
 }
 
 type GetLeaderboardResponse struct {
-	UserAddress string  `json:"user_address"`
-	NetProfit   float64 `json:"net_profit"`
+	UserAddress  string               `json:"user_address"`
+	UserName     string               `json:"user_name,omitempty"`
+	UserCategory common.LabelCategory `json:"user_category,omitempty"`
+	NetProfit    float64              `json:"net_profit"`
+
+	RealizedPnl   float64 `json:"realized_pnl"`
+	UnrealizedPnl float64 `json:"unrealized_pnl"`
 	// MostProfitableTradeToken common.Token `json:"most_profitable_trade_token"`
 	CurrentLargestPosition common.Token `json:"current_largest_position"`
 	MostTokenBuy           common.Token `json:"most_token_buy"`
@@ -351,7 +491,7 @@ func (s *Server) getLeaderboard(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get list user", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
@@ -373,27 +513,20 @@ func (s *Server) getLeaderboard(c *gin.Context) {
 		})
 	}
 
-	sort.Slice(arrData, func(i, j int) bool {
-		return arrData[i].value > arrData[j].value
-	})
+	page, next, err := request.dataPage(arrData)
+	if err != nil {
+		log.Errorw("invalid cursor when get leaderboard", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var topUserProfit []UserAddressResponse
-	st := (request.Start - 1) * request.Limit
-	ed := st + request.Limit - 1
-
-	for i := st; i <= ed; i++ {
-		if i >= len(arrData) {
-			break
-		}
-		u := arrData[i]
-		topUserProfit = append(topUserProfit, UserAddressResponse{
-			AddressResponse: AddressResponse{
-				Addr:  u.key,
-				Value: u.value,
-				Chain: request.Chain,
-			},
-			// TODO: add new of address
-		})
+	for _, u := range page {
+		topUserProfit = append(topUserProfit, s.userAddressResponse(chain, AddressResponse{
+			Addr:  u.key,
+			Value: u.value,
+			Chain: request.Chain,
+		}))
 	}
 
 	var res []GetLeaderboardResponse
@@ -418,8 +551,8 @@ func (s *Server) getLeaderboard(c *gin.Context) {
 		var largestPositionInUsdtValue float64
 
 		for _, tra := range trade {
-			tokenIn := strings.ToLower(tra.TokenInAddress)
-			tokenOut := strings.ToLower(tra.TokenOutAddress)
+			tokenIn := common.AddressKey(tra.TokenInAddress)
+			tokenOut := common.AddressKey(tra.TokenOutAddress)
 			valuePosition := tra.CurrentTokenOutUsdtRate * tra.TokenOutAmount
 			mostTokenIn[tokenOut] += valuePosition
 			mostTokenOut[tokenIn] += tra.CurrentTokenInUsdtRate * tra.TokenInAmount
@@ -432,19 +565,24 @@ func (s *Server) getLeaderboard(c *gin.Context) {
 				mostTokenOutAddress = tra.TokenInAddress
 				mostTokenOutValue = mostTokenOut[tokenIn]
 			}
-			if !util.IsQuote(tokenOut) && largestPositionInUsdtValue < valuePosition {
+			if !s.storage.IsQuote(chain, tokenOut) && largestPositionInUsdtValue < valuePosition {
 				largestPositionInUsdtValue = valuePosition
 				largestPositionAddress = tra.TokenOutAddress
 			}
 		}
 
-		mostTokenInInfo := addrToTokenInfo[strings.ToLower(mostTokenInAddress)]
-		mostTokenOutInfo := addrToTokenInfo[strings.ToLower(mostTokenOutAddress)]
-		largestPositionTokenInfo := addrToTokenInfo[strings.ToLower(largestPositionAddress)]
+		mostTokenInInfo := addrToTokenInfo[common.AddressKey(mostTokenInAddress)]
+		mostTokenOutInfo := addrToTokenInfo[common.AddressKey(mostTokenOutAddress)]
+		largestPositionTokenInfo := addrToTokenInfo[common.AddressKey(largestPositionAddress)]
 
+		pnl := s.storage.GetUserPnl(chain, t.Addr)
 		res = append(res, GetLeaderboardResponse{
 			UserAddress:            t.Addr,
+			UserName:               t.Name,
+			UserCategory:           t.Category,
 			NetProfit:              t.Value,
+			RealizedPnl:            pnl.RealizedPnl,
+			UnrealizedPnl:          pnl.UnrealizedPnl,
 			LastTrade:              lastTrade,
 			MostTokenBuy:           mostTokenInInfo,
 			MostTokenSell:          mostTokenOutInfo,
@@ -454,5 +592,6 @@ func (s *Server) getLeaderboard(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"leaderboard": res,
+		"next_cursor": next,
 	})
 }
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/common/utils"
+)
+
+const streamPingInterval = 15 * time.Second
+
+type GetActivitiesStreamRequest struct {
+	Chain  string `form:"chain" binding:"required"`
+	Action string `form:"action"`
+	Token  string `form:"token"`
+	Sender string `form:"sender"`
+	// FromBlock replays the stored activities from this block before the new ones
+	FromBlock uint64 `form:"from_block"`
+}
+
+// getActivitiesStream sends the new activities as server-sent events, the id of an event is the epoch and the
+// sequence number of the activity in the chain. A client resumes with the Last-Event-ID header from the activity
+// after that id, including the ones of older blocks that are added later, or replays the activities from from_block.
+// An id of another epoch, after a restart without snapshot, is resumed from from_block, or from the new activities
+// without from_block.
+func (s *Server) getActivitiesStream(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetActivitiesStreamRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get activities stream", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetActivities.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get activities stream", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		return
+	}
+
+	filter := storage.BigTxFilter{
+		Chain:  chain,
+		Token:  request.Token,
+		Sender: request.Sender,
+	}
+	if request.Action != "" {
+		filter.Action, err = common.SmartMoneyActivitiesString(request.Action)
+		if err != nil {
+			log.Errorw("invalid action when get activities stream", "action", request.Action, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetActivities.Error()})
+			return
+		}
+	}
+
+	var lastID storage.BigTxEventID
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID != "" {
+		lastID, err = storage.ParseBigTxEventID(lastEventID)
+		if err != nil {
+			log.Errorw("invalid last event id when get activities stream", "last_event_id", lastEventID, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetActivities.Error()})
+			return
+		}
+	}
+
+	// subscribe before reading the history so no activity is missed in between
+	sub, cancel := s.storage.SubscribeBigTx(filter)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// the activities up to the id of the replay are already stored, skip them in the subscription
+	var replay []common.BigTx
+	replayID := storage.BigTxEventID{Epoch: s.storage.GetBigTxEpoch(chain)}
+	resumed := false
+	if lastEventID != "" {
+		replay, replayID, resumed = s.storage.GetBigTxAfter(filter, lastID)
+		if !resumed {
+			log.Infow("last event id is of another epoch, resume by block", "last_event_id", lastEventID,
+				"epoch", replayID.Epoch, "seq", replayID.Seq, "from_block", request.FromBlock)
+		}
+	}
+	if !resumed && request.FromBlock > 0 {
+		replay, replayID = s.storage.GetBigTxFromBlock(filter, request.FromBlock)
+	}
+	if len(replay) > 0 {
+		for _, tx := range replay {
+			if err := s.writeActivityEvent(c.Writer, chain, replayID.Epoch, tx); err != nil {
+				log.Debugw("stop activities stream", "err", err)
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-ping.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case tx, ok := <-sub.C:
+			if !ok {
+				// the client is too slow, it reconnects with Last-Event-ID
+				log.Infow("activities stream subscription is dropped", "chain", chain)
+				return
+			}
+			if tx.Seq <= replayID.Seq {
+				continue
+			}
+			if err := s.writeActivityEvent(c.Writer, chain, replayID.Epoch, tx); err != nil {
+				log.Debugw("stop activities stream", "err", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func (s *Server) writeActivityEvent(w io.Writer, chain common.Chain, epoch uint64, tx common.BigTx) error {
+	info := s.storage.GetTokenInfoByAddress(chain, tx.TokenAddress)
+	data, err := json.Marshal(s.activityResponse(chain, tx, info))
+	if err != nil {
+		return err
+	}
+	id := storage.BigTxEventID{Epoch: epoch, Seq: tx.Seq}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: activity\ndata: %s\n\n", id, data)
+	return err
+}
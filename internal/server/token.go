@@ -7,14 +7,15 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/util"
 	"github.com/kv-base-hack/common/utils"
 )
 
 type GetTokenProfitRequest struct {
-	Duration time.Duration `form:"duration" binding:"required"`
-	Start    int           `form:"start" binding:"required,numeric,min=1"`
-	Limit    int           `form:"limit" binding:"required,numeric,min=1"`
-	Chain    string        `form:"chain" binding:"required"`
+	Duration string `form:"duration" binding:"required"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
 }
 
 type GetTokenProfitRes struct {
@@ -37,14 +38,21 @@ func (s *Server) getTokenProfit(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopTokenProfitRequest.Error()})
 		return
 	}
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get token profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	tradeLogs, err := s.storage.GetTradeLogs(chain, request.Duration)
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get token profit", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	tradeLogs, err := s.storage.GetTradeLogs(chain, duration)
 	if err != nil {
 		log.Errorw("invalid duration when get token profit", "duration", request.Duration, "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -57,21 +65,26 @@ func (s *Server) getTokenProfit(c *gin.Context) {
 
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
 
-	topTokenProfit := s.getTopToken(chain, tradeLogs.TokenProfit, addrToTokenInfo, request.Start, request.Limit)
+	topTokenProfit, next, err := s.getTopToken(chain, tradeLogs.TokenProfit, addrToTokenInfo, request.Pagination)
+	if err != nil {
+		log.Errorw("invalid cursor when get token profit", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	tokenInFlowInUsdt, err := s.storage.GetTokenInFlowInUsdt(chain, request.Duration)
+	tokenInFlowInUsdt, err := s.storage.GetTokenInFlowInUsdt(chain, duration)
 	if err != nil {
 		log.Errorw("invalid request when get token profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopTokenProfitRequest.Error()})
 		return
 	}
-	tokenInFlow, err := s.storage.GetTokenInFlow(chain, request.Duration)
+	tokenInFlow, err := s.storage.GetTokenInFlow(chain, duration)
 	if err != nil {
 		log.Errorw("invalid request when get token profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopTokenProfitRequest.Error()})
 		return
 	}
-	tokenOutFlow, err := s.storage.GetTokenOutFlow(chain, request.Duration)
+	tokenOutFlow, err := s.storage.GetTokenOutFlow(chain, duration)
 	if err != nil {
 		log.Errorw("invalid request when get token profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopTokenProfitRequest.Error()})
@@ -79,7 +92,7 @@ func (s *Server) getTokenProfit(c *gin.Context) {
 	}
 	res := []GetTokenProfitRes{}
 	for _, t := range topTokenProfit {
-		addr := strings.ToLower(t.Addr)
+		addr := common.AddressKey(t.Addr)
 		inUdst := tokenInFlowInUsdt[addr]
 		in := tokenInFlow[addr]
 		out := tokenOutFlow[addr]
@@ -93,13 +106,14 @@ func (s *Server) getTokenProfit(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"top_token_profit": res,
+		"next_cursor":      next,
 	})
 }
 
 type GetTokenInspectSellBuy struct {
-	Chain    string        `form:"chain" binding:"required"`
-	Address  string        `form:"address" binding:"required"`
-	Duration time.Duration `form:"duration" binding:"required"`
+	Chain    string `form:"chain" binding:"required"`
+	Address  string `form:"address" binding:"required"`
+	Duration string `form:"duration" binding:"required"`
 }
 
 func (s *Server) tokenInspectBuySell(c *gin.Context) {
@@ -111,20 +125,27 @@ func (s *Server) tokenInspectBuySell(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTokenInspect.Error()})
 		return
 	}
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get token profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	tradeLogs, err := s.storage.GetTradeLogs(chain, request.Duration)
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get token inspect sell buy", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	tradeLogs, err := s.storage.GetTradeLogs(chain, duration)
 	if err != nil {
 		log.Errorw("invalid request when get token inspect sell buy", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTokenInspect.Error()})
 		return
 	}
-	addr := strings.ToLower(request.Address)
+	addr := common.AddressKey(request.Address)
 	inFlowIntoken := tradeLogs.TokenInFlow[addr]
 	inFlowInUsdt := tradeLogs.TokenInFlowInUsdt[addr]
 
@@ -140,9 +161,9 @@ func (s *Server) tokenInspectBuySell(c *gin.Context) {
 }
 
 type GetTokenInspectDepositWithdraw struct {
-	Chain    string        `form:"chain" binding:"required"`
-	Address  string        `form:"address" binding:"required"`
-	Duration time.Duration `form:"duration" binding:"required"`
+	Chain    string `form:"chain" binding:"required"`
+	Address  string `form:"address" binding:"required"`
+	Duration string `form:"duration" binding:"required"`
 }
 
 func (s *Server) tokenInspectDepositWithdraw(c *gin.Context) {
@@ -155,32 +176,51 @@ func (s *Server) tokenInspectDepositWithdraw(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get token profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	transfer, err := s.storage.GetTransferLogs(chain, request.Duration)
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get token inspect deposit withdraw", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	transfer, err := s.storage.GetTransferLogs(chain, duration)
 	if err != nil {
 		log.Errorw("invalid request when get token inspect deposit withdraw", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTokenInspect.Error()})
 		return
 	}
 
-	addr := strings.ToLower(request.Address)
+	addr := common.AddressKey(request.Address)
 	cexInFlowInUsdt := transfer.CexInFlowInUsdt[addr]
 	cexInFlow := transfer.CexInFlow[addr]
 
 	cexOutFlowInUsdt := transfer.CexOutFlowInUsdt[addr]
 	cexOutFlow := transfer.CexOutFlow[addr]
 
+	flows, err := s.storage.GetExchangeFlows(chain, duration, addr)
+	if err != nil {
+		log.Errorw("invalid request when get token inspect deposit withdraw", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTokenInspect.Error()})
+		return
+	}
+	exchanges := make([]ExchangeFlowResponse, 0, len(flows))
+	for _, f := range flows {
+		exchanges = append(exchanges, newExchangeFlowResponse(f))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"cex_in_flow":          cexInFlow,
 		"cex_in_flow_in_usdt":  cexInFlowInUsdt,
 		"cex_out_flow_in_usdt": cexOutFlowInUsdt,
 		"cex_out_flow":         cexOutFlow,
+		"exchanges":            exchanges,
 	})
 }
 
@@ -188,8 +228,7 @@ type GetTokenInspectActivitiesRequest struct {
 	Action       string `form:"action" binding:"required"`
 	Chain        string `form:"chain" binding:"required"`
 	TokenAddress string `form:"address" binding:"required"`
-	Start        int    `form:"start" binding:"required,numeric,min=1"`
-	Limit        int    `form:"limit" binding:"required,numeric,min=1"`
+	Pagination
 }
 
 type GetTokenInspectActivitiesResponse struct {
@@ -209,7 +248,7 @@ func (s *Server) tokenInspectActivities(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get token inspect activities", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
@@ -223,29 +262,26 @@ func (s *Server) tokenInspectActivities(c *gin.Context) {
 		return
 	}
 
-	activities := s.storage.GetLastBigTxForToken(chain, action, defaultLength, request.TokenAddress)
+	activities, total, next, err := request.bigTxPage(func(last int, before storage.BigTxCursor) ([]common.BigTx, int) {
+		return s.storage.GetLastBigTxForToken(chain, action, last, before, request.TokenAddress)
+	})
+	if err != nil {
+		log.Errorw("invalid cursor when get token inspect activities", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
-	st := (request.Start - 1) * request.Limit
-	ed := st + request.Limit - 1
 
 	act := []GetActivitiesResponse{}
-
-	for i := st; i <= ed; i++ {
-		if i >= len(activities) {
-			break
-		}
-		a := activities[i]
-		info := addrToTokenInfo[strings.ToLower(a.TokenAddress)]
-		act = append(act, GetActivitiesResponse{
-			BigTx:         a,
-			TokenSymbol:   info.Symbol,
-			TokenImageUrl: info.ImageUrl,
-			ChainID:       info.ChainID,
-		})
+	for _, a := range activities {
+		info := addrToTokenInfo[common.AddressKey(a.TokenAddress)]
+		act = append(act, s.activityResponse(chain, a, info))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"activities": act,
+		"activities":  act,
+		"next_cursor": next,
+		"total":       total,
 	})
 }
 
@@ -272,7 +308,7 @@ func (s *Server) listToken(c *gin.Context) {
 		return
 	}
 	log.Infow("get list tokens", "chain", request.Chain)
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get list token", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
@@ -284,7 +320,7 @@ func (s *Server) listToken(c *gin.Context) {
 	res := []ListTokenResponse{}
 	search := strings.ToLower(request.SymbolSearch)
 	for _, t := range tokens {
-		info := addrToTokenInfo[strings.ToLower(t)]
+		info := addrToTokenInfo[common.AddressKey(t)]
 
 		pass := search == "" || strings.Contains(strings.ToLower(t), search) ||
 			strings.Contains(strings.ToLower(info.Symbol), search)
@@ -318,11 +354,32 @@ type TokenTrendingReponse struct {
 	ChainID                  string  `json:"chain_id"`
 }
 
+type TokenTrendingRequest struct {
+	Chain string `form:"chain"`
+}
+
 func (s *Server) getTokenTrending(c *gin.Context) {
 	log := s.log.With("ID", utils.RandomString(29))
 	log.Infow("get trending tokens")
 
-	addrToTokenInfo := s.storage.GetTokenInfo(common.ChainBase)
+	var request TokenTrendingRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get trending tokens", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		return
+	}
+	// trending tokens are from coingecko, base is the default chain to get the address
+	if request.Chain == "" {
+		request.Chain = common.ChainBase.String()
+	}
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get trending tokens", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		return
+	}
+
+	addrToTokenInfo := s.storage.GetTokenInfo(chain)
 	mappingSymbolToTokenInfo := map[string]common.Token{}
 	for _, t := range addrToTokenInfo {
 		mappingSymbolToTokenInfo[t.Symbol] = t
@@ -334,7 +391,7 @@ func (s *Server) getTokenTrending(c *gin.Context) {
 		info := mappingSymbolToTokenInfo[t.Item.Symbol]
 		var addr string
 		var chainID string
-		if info.ChainID == common.ChainBase.String() {
+		if info.ChainID == chain.String() {
 			addr = info.Address
 			chainID = info.ChainID
 		}
@@ -373,7 +430,7 @@ func (s *Server) getTokenInfo(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get token info", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetTokenInfo.Error()})
@@ -381,7 +438,7 @@ func (s *Server) getTokenInfo(c *gin.Context) {
 	}
 
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
-	token := addrToTokenInfo[strings.ToLower(request.Address)]
+	token := addrToTokenInfo[common.AddressKey(request.Address)]
 	info := s.storage.GetTokenInfoFromSymbol(token.Symbol)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -412,23 +469,79 @@ func (s *Server) getPriceWithTransfer(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get price with transfer", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	deposit, withdraw := s.storage.GetPriceWithTransferByRange(chain, strings.ToLower(request.Address))
+	deposit, withdraw, price := s.storage.GetPriceWithTransferByRange(chain, common.AddressKey(request.Address))
 	res := map[string]PriceWithTransferResponse{}
-	for date, value := range deposit {
-		res[date] = PriceWithTransferResponse{
-			Date:     date,
-			Deposit:  value,
-			Withdraw: withdraw[date],
+	for _, dates := range []storage.TokenTransfer{deposit, withdraw, price} {
+		for date := range dates {
+			res[date] = PriceWithTransferResponse{
+				Date:     date,
+				Deposit:  deposit[date],
+				Withdraw: withdraw[date],
+				Price:    price[date],
+			}
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"price_with_transfer": res,
 	})
 }
+
+type GetTokenCandlesRequest struct {
+	Chain    string `form:"chain" binding:"required"`
+	Address  string `form:"address" binding:"required"`
+	Interval string `form:"interval" binding:"required"`
+	// From and To are unix seconds, default is the retention of the interval until now
+	From int64 `form:"from"`
+	To   int64 `form:"to"`
+}
+
+func (s *Server) getTokenCandles(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetTokenCandlesRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get token candles", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetTokenCandles.Error()})
+		return
+	}
+
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		log.Errorw("invalid request when get token candles", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		return
+	}
+
+	interval, err := storage.CandleIntervalString(request.Interval)
+	if err != nil {
+		log.Errorw("invalid interval when get token candles", "interval", request.Interval, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetTokenCandles.Error()})
+		return
+	}
+
+	to := time.Now()
+	if request.To > 0 {
+		to = time.Unix(request.To, 0)
+	}
+	from := to.Add(-interval.Retention())
+	if request.From > 0 {
+		from = time.Unix(request.From, 0)
+	}
+	if from.After(to) {
+		log.Errorw("invalid range when get token candles", "from", request.From, "to", request.To)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetTokenCandles.Error()})
+		return
+	}
+
+	candles := s.storage.GetTokenCandles(chain, request.Address, interval, from, to)
+	c.JSON(http.StatusOK, gin.H{
+		"candles": candles,
+	})
+}
@@ -3,22 +3,38 @@ package server
 import (
 	"encoding/json"
 	"net/http"
-	"sort"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/util"
 	"github.com/kv-base-hack/common/utils"
 )
 
 type GetUserProfitRequest struct {
-	Duration time.Duration `form:"duration" binding:"required"`
-	Start    int           `form:"start" binding:"required,numeric,min=1"`
-	Limit    int           `form:"limit" binding:"required,numeric,min=1"`
-	Chain    string        `form:"chain" binding:"required"`
+	// Duration is required by the profit sort, the pnl sorts rank the all time pnl of the ledger and reject it
+	Duration string `form:"duration"`
+	Pagination
+	Chain string `form:"chain" binding:"required"`
+	// SortBy is one of profit, realized_pnl, unrealized_pnl, total_pnl, default is profit
+	SortBy string `form:"sort_by"`
 }
 
+type UserProfitResponse struct {
+	UserAddressResponse
+	RealizedPnl   float64 `json:"realized_pnl"`
+	UnrealizedPnl float64 `json:"unrealized_pnl"`
+	TotalPnl      float64 `json:"total_pnl"`
+}
+
+const (
+	sortByProfit        = "profit"
+	sortByRealizedPnl   = "realized_pnl"
+	sortByUnrealizedPnl = "unrealized_pnl"
+	sortByTotalPnl      = "total_pnl"
+)
+
 func (s *Server) getUserProfit(c *gin.Context) {
 	log := s.log.With("ID", utils.RandomString(29))
 	now := time.Now()
@@ -33,64 +49,95 @@ func (s *Server) getUserProfit(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get top user profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	tradeLogs, err := s.storage.GetTradeLogs(chain, request.Duration)
-	if err != nil {
-		log.Errorw("invalid duration when get user profit", "duration", request.Duration, "err", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	log.Infow("get top user profit",
-		"chain", chain,
-		"request", request,
-		"tradeBlockTs", tradeLogs.StorageByRangeIndex)
-
 	arrData := []Data{}
-	for k, v := range tradeLogs.UserProfit {
-		arrData = append(arrData, Data{
-			key:   k,
-			value: v,
-		})
-	}
+	switch request.SortBy {
+	case "", sortByProfit:
+		duration, err := util.ParseDuration(request.Duration)
+		if err != nil {
+			log.Errorw("invalid duration when get user profit", "duration", request.Duration, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+			return
+		}
 
-	sort.Slice(arrData, func(i, j int) bool {
-		return arrData[i].value > arrData[j].value
-	})
+		tradeLogs, err := s.storage.GetTradeLogs(chain, duration)
+		if err != nil {
+			log.Errorw("invalid duration when get user profit", "duration", request.Duration, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		log.Infow("get top user profit",
+			"chain", chain,
+			"request", request,
+			"tradeBlockTs", tradeLogs.StorageByRangeIndex)
 
-	var topUserProfit []UserAddressResponse
-	st := (request.Start - 1) * request.Limit
-	ed := st + request.Limit - 1
+		for k, v := range tradeLogs.UserProfit {
+			arrData = append(arrData, Data{key: k, value: v})
+		}
+	case sortByRealizedPnl, sortByUnrealizedPnl, sortByTotalPnl:
+		// the ledger keeps the pnl since the first ingested trade, it can't be ranked within a window
+		if request.Duration != "" {
+			log.Errorw("duration with pnl sort when get user profit", "duration", request.Duration, "sort_by", request.SortBy)
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrDurationOfPnlSort.Error()})
+			return
+		}
 
-	for i := st; i <= ed; i++ {
-		if i >= len(arrData) {
-			break
+		log.Infow("get top user pnl", "chain", chain, "request", request)
+
+		// all wallets are ranked by pnl, the pnl of the page is read again below
+		for k, v := range s.storage.GetAllUserPnl(chain) {
+			value := v.TotalPnl()
+			if request.SortBy == sortByRealizedPnl {
+				value = v.RealizedPnl
+			} else if request.SortBy == sortByUnrealizedPnl {
+				value = v.UnrealizedPnl
+			}
+			arrData = append(arrData, Data{key: k, value: value})
 		}
-		u := arrData[i]
-		topUserProfit = append(topUserProfit, UserAddressResponse{
-			AddressResponse: AddressResponse{
+	default:
+		log.Errorw("invalid sort by when get user profit", "sort_by", request.SortBy)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidTopUserProfitRequest.Error()})
+		return
+	}
+
+	page, next, err := request.dataPage(arrData)
+	if err != nil {
+		log.Errorw("invalid cursor when get user profit", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var topUserProfit []UserProfitResponse
+	for _, u := range page {
+		pnl := s.storage.GetUserPnl(chain, u.key)
+		topUserProfit = append(topUserProfit, UserProfitResponse{
+			UserAddressResponse: s.userAddressResponse(chain, AddressResponse{
 				Addr:  u.key,
 				Value: u.value,
 				Chain: request.Chain,
-			},
-			// TODO: add new of address
+			}),
+			RealizedPnl:   pnl.RealizedPnl,
+			UnrealizedPnl: pnl.UnrealizedPnl,
+			TotalPnl:      pnl.TotalPnl(),
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"top_user_profit": topUserProfit,
+		"next_cursor":     next,
 	})
 }
 
 type UserInspect struct {
-	Chain    string        `form:"chain" binding:"required"`
-	Address  string        `form:"address" binding:"required"`
-	Duration time.Duration `form:"duration" binding:"required"`
+	Chain    string `form:"chain" binding:"required"`
+	Address  string `form:"address" binding:"required"`
+	Duration string `form:"duration" binding:"required"`
 }
 
 func (s *Server) userInspect(c *gin.Context) {
@@ -103,14 +150,21 @@ func (s *Server) userInspect(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get top user profit", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	fromTime := time.Now().Add(-request.Duration)
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get user inspect", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	fromTime := time.Now().Add(-duration)
 	tradeLogs := s.storage.GetTradeLogsForUser(chain, fromTime, request.Address)
 
 	txProfit := make(map[string]float64)
@@ -132,8 +186,7 @@ type GetUserInspectActivitiesRequest struct {
 	Action      string `form:"action" binding:"required"`
 	Chain       string `form:"chain" binding:"required"`
 	UserAddress string `form:"address" binding:"required"`
-	Start       int    `form:"start" binding:"required,numeric,min=1"`
-	Limit       int    `form:"limit" binding:"required,numeric,min=1"`
+	Pagination
 }
 
 type GetUserInspectActivitiesResponse struct {
@@ -153,7 +206,7 @@ func (s *Server) userInspectActivities(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get user inspect activities", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
@@ -167,28 +220,26 @@ func (s *Server) userInspectActivities(c *gin.Context) {
 		return
 	}
 
-	activities := s.storage.GetLastBigTxForUser(chain, action, defaultLength, request.UserAddress)
+	activities, total, next, err := request.bigTxPage(func(last int, before storage.BigTxCursor) ([]common.BigTx, int) {
+		return s.storage.GetLastBigTxForUser(chain, action, last, before, request.UserAddress)
+	})
+	if err != nil {
+		log.Errorw("invalid cursor when get user inspect activities", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
-	st := (request.Start - 1) * request.Limit
-	ed := st + request.Limit - 1
 
 	act := []GetActivitiesResponse{}
-	for i := st; i <= ed; i++ {
-		if i >= len(activities) {
-			break
-		}
-		a := activities[i]
-		info := addrToTokenInfo[strings.ToLower(a.TokenAddress)]
-		act = append(act, GetActivitiesResponse{
-			BigTx:         a,
-			TokenSymbol:   info.Symbol,
-			TokenImageUrl: info.ImageUrl,
-			ChainID:       info.ChainID,
-		})
+	for _, a := range activities {
+		info := addrToTokenInfo[common.AddressKey(a.TokenAddress)]
+		act = append(act, s.activityResponse(chain, a, info))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"activities": act,
+		"activities":  act,
+		"next_cursor": next,
+		"total":       total,
 	})
 }
 
@@ -202,6 +253,9 @@ type GetUserBalanceResponse struct {
 	TotalBalance  float64                `json:"total_balance,omitempty"`
 	Profit        float64                `json:"profit,omitempty"`
 	PnlPercent    float64                `json:"pnl_percent,omitempty"`
+	RealizedPnl   float64                `json:"realized_pnl,omitempty"`
+	UnrealizedPnl float64                `json:"unrealized_pnl,omitempty"`
+	CostBasis     float64                `json:"cost_basis,omitempty"`
 	TokenBalances []TokenBalanceResponse `json:"token_balances,omitempty"`
 }
 
@@ -223,23 +277,22 @@ func (s *Server) getUserBalances(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get user inspect activities", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	trades, err := s.storage.GetTradeLogs(chain, time.Hour*24)
-	if err != nil {
-		log.Errorw("invalid request when get user balances", "err", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetUserBalances.Error()})
-		return
+	userPnl := s.storage.GetUserPnl(chain, request.Address)
+	tokenPnl := make(map[string]storage.TokenPnl, len(userPnl.Tokens))
+	for _, t := range userPnl.Tokens {
+		tokenPnl[t.Token] = t
 	}
-	profit := trades.UserProfit[request.Address]
+	profit := userPnl.TotalPnl()
 	totalBalance := 0.0
 
-	balancesStr, err := s.inMemDB.Get(chain.String() + "_" + strings.ToLower(request.Address))
+	balancesStr, err := s.inMemDB.Get(chain.String() + "_" + common.AddressKey(request.Address))
 	if err != nil {
 		log.Errorw("couldn't get user balance", "err", err)
 	}
@@ -253,17 +306,22 @@ func (s *Server) getUserBalances(c *gin.Context) {
 
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
 	for _, balance := range balances {
-		info := addrToTokenInfo[strings.ToLower(balance.Address)]
+		info := addrToTokenInfo[common.AddressKey(balance.Address)]
+		pnl := tokenPnl[common.AddressKey(balance.Address)]
 		userBalances = append(userBalances, TokenBalanceResponse{
-			Symbol:   info.Symbol,
-			ImageUrl: info.ImageUrl,
-			Amount:   balance.Amount,
+			Symbol:     info.Symbol,
+			ImageUrl:   info.ImageUrl,
+			Amount:     balance.Amount,
+			TotalSpent: pnl.CostBasis,
+			Pnl:        pnl.RealizedPnl + pnl.UnrealizedPnl,
 		})
 		totalBalance += info.UsdPrice * balance.Amount
 	}
 
 	var pnlPercent float64
-	if totalBalance > 0 {
+	if userPnl.CostBasis > 0 {
+		pnlPercent = profit / userPnl.CostBasis * 100
+	} else if totalBalance > 0 {
 		pnlPercent = profit / totalBalance * 100
 	}
 
@@ -272,6 +330,9 @@ func (s *Server) getUserBalances(c *gin.Context) {
 		TotalBalance:  totalBalance,
 		Profit:        profit,
 		PnlPercent:    pnlPercent,
+		RealizedPnl:   userPnl.RealizedPnl,
+		UnrealizedPnl: userPnl.UnrealizedPnl,
+		CostBasis:     userPnl.CostBasis,
 		TokenBalances: userBalances,
 	}
 
@@ -283,8 +344,7 @@ func (s *Server) getUserBalances(c *gin.Context) {
 type GetUserPortfolioRequest struct {
 	Chain   string `form:"chain" binding:"required"`
 	Address string `form:"address" binding:"required"`
-	Start   int    `form:"start" binding:"required,numeric,min=1"`
-	Limit   int    `form:"limit" binding:"required,numeric,min=1"`
+	Pagination
 }
 
 func (s *Server) getUserPortfolio(c *gin.Context) {
@@ -297,14 +357,14 @@ func (s *Server) getUserPortfolio(c *gin.Context) {
 		return
 	}
 
-	chain, err := common.ChainString(request.Chain)
+	chain, err := s.parseChain(request.Chain)
 	if err != nil {
 		log.Errorw("invalid request when get user inspect activities", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
 		return
 	}
 
-	balancesStr, err := s.inMemDB.Get(chain.String() + "_" + strings.ToLower(request.Address))
+	balancesStr, err := s.inMemDB.Get(chain.String() + "_" + common.AddressKey(request.Address))
 	if err != nil {
 		log.Errorw("couldn't get user balance", "err", err)
 	}
@@ -314,25 +374,40 @@ func (s *Server) getUserPortfolio(c *gin.Context) {
 		log.Errorw("couldn't parse user balance user balance", "balancesStr", balancesStr, "err", err)
 	}
 
-	tokens := []TokenBalanceResponse{}
 	addrToTokenInfo := s.storage.GetTokenInfo(chain)
+	amounts := make(map[string]float64, len(balances))
+	for _, balance := range balances {
+		amounts[common.AddressKey(balance.Address)] += balance.Amount
+	}
+	arrData := make([]Data, 0, len(amounts))
+	for address, amount := range amounts {
+		arrData = append(arrData, Data{
+			key:   address,
+			value: amount * addrToTokenInfo[address].UsdPrice,
+		})
+	}
 
-	st := (request.Start - 1) * request.Limit
-	ed := st + request.Limit - 1
-	for i := st; i <= ed; i++ {
-		if i >= len(balances) {
-			break
-		}
-		info := addrToTokenInfo[strings.ToLower(balances[i].Address)]
+	// tokens are ordered by usd value so the cursor is stable
+	page, next, err := request.dataPage(arrData)
+	if err != nil {
+		log.Errorw("invalid cursor when get user portfolio", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens := []TokenBalanceResponse{}
+	for _, t := range page {
+		info := addrToTokenInfo[t.key]
 		tokens = append(tokens, TokenBalanceResponse{
 			Symbol:   info.Symbol,
 			ImageUrl: info.ImageUrl,
-			Amount:   balances[i].Amount,
+			Amount:   amounts[t.key],
 		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"tokens": tokens,
-		"total":  len(balances),
+		"tokens":      tokens,
+		"next_cursor": next,
+		"total":       len(balances),
 	})
 }
@@ -0,0 +1,563 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/storage/db"
+	"github.com/kv-base-hack/base-server-api/util"
+	"github.com/kv-base-hack/common/utils"
+	"go.uber.org/zap"
+)
+
+// maxWatchlistAddresses is the maximum number of addresses of a watchlist
+const maxWatchlistAddresses = 200
+
+type WatchlistRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Chain     string   `json:"chain" binding:"required"`
+	Kind      string   `json:"kind" binding:"required"`
+	Addresses []string `json:"addresses"`
+}
+
+// parseWatchlist checks the request and returns the watchlist with the trimmed addresses without duplicates,
+// the addresses are stored as given and only keyed with common.AddressKey for the lookups.
+func (s *Server) parseWatchlist(request WatchlistRequest) (common.Watchlist, error) {
+	chain, err := s.parseChain(request.Chain)
+	if err != nil {
+		return common.Watchlist{}, err
+	}
+	kind, err := common.WatchlistKindString(request.Kind)
+	if err != nil {
+		return common.Watchlist{}, err
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return common.Watchlist{}, errors.New("missing name")
+	}
+
+	addresses := make([]string, 0, len(request.Addresses))
+	added := make(map[string]bool, len(request.Addresses))
+	for _, addr := range request.Addresses {
+		addr = strings.TrimSpace(addr)
+		key := common.AddressKey(addr)
+		if addr == "" || added[key] {
+			continue
+		}
+		added[key] = true
+		addresses = append(addresses, addr)
+	}
+	if len(addresses) > maxWatchlistAddresses {
+		return common.Watchlist{}, errors.New("too many addresses")
+	}
+	return common.Watchlist{
+		Name:      name,
+		Chain:     chain,
+		Kind:      kind,
+		Addresses: addresses,
+	}, nil
+}
+
+// watchlistError writes the response of an error of the watchlist database.
+func watchlistError(c *gin.Context, log *zap.SugaredLogger, action string, err error) {
+	log.Errorw("error when "+action+" watchlist", "err", err)
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrWatchlistNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// getWatchlistOf returns the watchlist of the id in the path, it writes the error response if it fails.
+func (s *Server) getWatchlistOf(c *gin.Context, log *zap.SugaredLogger) (common.Watchlist, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Errorw("invalid watchlist id", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return common.Watchlist{}, false
+	}
+	w, err := s.watchlists.GetWatchlist(id)
+	if err != nil {
+		watchlistError(c, log, "get", err)
+		return common.Watchlist{}, false
+	}
+	if !s.storage.IsSupportedChain(w.Chain) {
+		log.Errorw("watchlist of unsupported chain", "id", id, "chain", w.Chain)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidListToken.Error()})
+		return common.Watchlist{}, false
+	}
+	return w, true
+}
+
+type ListWatchlistsRequest struct {
+	Chain string `form:"chain"`
+}
+
+// listWatchlists returns all watchlists, or the watchlists of the chain.
+func (s *Server) listWatchlists(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request ListWatchlistsRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when list watchlists", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	watchlists, err := s.watchlists.GetWatchlists()
+	if err != nil {
+		watchlistError(c, log, "list", err)
+		return
+	}
+	res := make([]common.Watchlist, 0, len(watchlists))
+	for _, w := range watchlists {
+		if request.Chain == "" || strings.EqualFold(w.Chain.String(), request.Chain) {
+			res = append(res, w)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlists": res,
+	})
+}
+
+func (s *Server) getWatchlist(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	w, ok := s.getWatchlistOf(c, log)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlist": w,
+	})
+}
+
+func (s *Server) createWatchlist(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request WatchlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when create watchlist", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	w, err := s.parseWatchlist(request)
+	if err != nil {
+		log.Errorw("invalid watchlist", "request", request, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error() + ": " + err.Error()})
+		return
+	}
+
+	w, err = s.watchlists.CreateWatchlist(w)
+	if err != nil {
+		watchlistError(c, log, "create", err)
+		return
+	}
+	log.Infow("create watchlist", "id", w.ID, "name", w.Name, "addresses", len(w.Addresses))
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlist": w,
+	})
+}
+
+// updateWatchlist replaces the name, chain, kind and addresses of the watchlist.
+func (s *Server) updateWatchlist(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Errorw("invalid watchlist id", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	var request WatchlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Errorw("invalid request when update watchlist", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	w, err := s.parseWatchlist(request)
+	if err != nil {
+		log.Errorw("invalid watchlist", "request", request, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error() + ": " + err.Error()})
+		return
+	}
+	w.ID = id
+
+	if err := s.watchlists.UpdateWatchlist(w); err != nil {
+		watchlistError(c, log, "update", err)
+		return
+	}
+	if w, err = s.watchlists.GetWatchlist(id); err != nil {
+		watchlistError(c, log, "get", err)
+		return
+	}
+	log.Infow("update watchlist", "id", w.ID, "name", w.Name, "addresses", len(w.Addresses))
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlist": w,
+	})
+}
+
+func (s *Server) deleteWatchlist(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Errorw("invalid watchlist id", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	if err := s.watchlists.DeleteWatchlist(id); err != nil {
+		watchlistError(c, log, "delete", err)
+		return
+	}
+	log.Infow("delete watchlist", "id", id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id": id,
+	})
+}
+
+type GetWatchlistActivitiesRequest struct {
+	Action string `form:"action" binding:"required"`
+	Pagination
+}
+
+// getWatchlistActivities returns the big transactions of the wallets or of the tokens of the watchlist.
+func (s *Server) getWatchlistActivities(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetWatchlistActivitiesRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get watchlist activities", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	action, err := common.SmartMoneyActivitiesString(request.Action)
+	if err != nil {
+		log.Errorw("invalid request when get watchlist activities", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidGetActivities.Error()})
+		return
+	}
+
+	w, ok := s.getWatchlistOf(c, log)
+	if !ok {
+		return
+	}
+
+	activities, total, next, err := request.bigTxPage(func(last int, before storage.BigTxCursor) ([]common.BigTx, int) {
+		if w.Kind == common.WatchlistKindToken {
+			return s.storage.GetLastBigTxForTokens(w.Chain, action, last, before, w.Addresses)
+		}
+		return s.storage.GetLastBigTxForUsers(w.Chain, action, last, before, w.Addresses)
+	})
+	if err != nil {
+		log.Errorw("invalid cursor when get watchlist activities", "cursor", request.Cursor, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	addrToTokenInfo := s.storage.GetTokenInfo(w.Chain)
+
+	act := []GetActivitiesResponse{}
+	for _, a := range activities {
+		info := addrToTokenInfo[common.AddressKey(a.TokenAddress)]
+		act = append(act, s.activityResponse(w.Chain, a, info))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlist":   w,
+		"activities":  act,
+		"next_cursor": next,
+		"total":       total,
+	})
+}
+
+type GetWatchlistPnlRequest struct {
+	// window of the token profit of the token watchlists, 24h if empty
+	Duration string `form:"duration"`
+}
+
+type WatchlistWalletPnl struct {
+	UserAddressResponse
+	CostBasis     float64 `json:"cost_basis"`
+	RealizedPnl   float64 `json:"realized_pnl"`
+	UnrealizedPnl float64 `json:"unrealized_pnl"`
+}
+
+// getWatchlistPnl returns the pnl of each wallet and the sum for the wallet watchlists, the value is the total pnl.
+// It returns the profit of each token in duration and the sum for the token watchlists.
+func (s *Server) getWatchlistPnl(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetWatchlistPnlRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get watchlist pnl", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+	if request.Duration == "" {
+		request.Duration = "24h"
+	}
+
+	w, ok := s.getWatchlistOf(c, log)
+	if !ok {
+		return
+	}
+
+	if w.Kind == common.WatchlistKindToken {
+		duration, err := util.ParseDuration(request.Duration)
+		if err != nil {
+			log.Errorw("invalid duration when get watchlist pnl", "duration", request.Duration, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+			return
+		}
+		tradeLogs, err := s.storage.GetTradeLogs(w.Chain, duration)
+		if err != nil {
+			log.Errorw("invalid duration when get watchlist pnl", "duration", request.Duration, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		addrToTokenInfo := s.storage.GetTokenInfo(w.Chain)
+		tokens := make([]TokenAddressResponse, 0, len(w.Addresses))
+		var total float64
+		for _, addr := range w.Addresses {
+			profit := tradeLogs.TokenProfit[common.AddressKey(addr)]
+			total += profit
+			tokens = append(tokens, tokenAddressResponse(w.Chain, addr, profit, addrToTokenInfo))
+		}
+		sort.Slice(tokens, func(i, j int) bool {
+			return tokens[i].Value > tokens[j].Value
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"watchlist":    w,
+			"tokens":       tokens,
+			"total_profit": total,
+		})
+		return
+	}
+
+	var total storage.UserPnl
+	wallets := make([]WatchlistWalletPnl, 0, len(w.Addresses))
+	for _, addr := range w.Addresses {
+		pnl := s.storage.GetUserPnl(w.Chain, addr)
+		total.CostBasis += pnl.CostBasis
+		total.RealizedPnl += pnl.RealizedPnl
+		total.UnrealizedPnl += pnl.UnrealizedPnl
+		wallets = append(wallets, WatchlistWalletPnl{
+			UserAddressResponse: s.userAddressResponse(w.Chain, AddressResponse{
+				Addr:  addr,
+				Value: pnl.TotalPnl(),
+				Chain: w.Chain.String(),
+			}),
+			CostBasis:     pnl.CostBasis,
+			RealizedPnl:   pnl.RealizedPnl,
+			UnrealizedPnl: pnl.UnrealizedPnl,
+		})
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return wallets[i].Value > wallets[j].Value
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlist":      w,
+		"wallets":        wallets,
+		"cost_basis":     total.CostBasis,
+		"realized_pnl":   total.RealizedPnl,
+		"unrealized_pnl": total.UnrealizedPnl,
+		"total_pnl":      total.TotalPnl(),
+	})
+}
+
+type GetWatchlistFlowsRequest struct {
+	Duration string `form:"duration" binding:"required"`
+}
+
+// WatchlistFlow is the flows in usdt of a token or a wallet, the value is the dex net flow.
+type WatchlistFlow struct {
+	AddressResponse
+	Symbol   string `json:"symbol,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Name     string `json:"name,omitempty"`
+
+	BuyInUsdt  float64 `json:"buy_in_usdt"`
+	SellInUsdt float64 `json:"sell_in_usdt"`
+	// only set for the tokens of the token watchlists
+	CexInFlowInUsdt  float64 `json:"cex_in_flow_in_usdt,omitempty"`
+	CexOutFlowInUsdt float64 `json:"cex_out_flow_in_usdt,omitempty"`
+	CexNetFlowInUsdt float64 `json:"cex_net_flow_in_usdt,omitempty"`
+}
+
+func (f *WatchlistFlow) add(other WatchlistFlow) {
+	f.Value += other.Value
+	f.BuyInUsdt += other.BuyInUsdt
+	f.SellInUsdt += other.SellInUsdt
+	f.CexInFlowInUsdt += other.CexInFlowInUsdt
+	f.CexOutFlowInUsdt += other.CexOutFlowInUsdt
+	f.CexNetFlowInUsdt += other.CexNetFlowInUsdt
+}
+
+// getWatchlistFlows returns the flows in duration of each token and the sum for the token watchlists: the dex buy and
+// sell, and the cex in and out flows. It returns the buy and sell of the non quote tokens by each wallet, and by token
+// for all wallets, for the wallet watchlists.
+func (s *Server) getWatchlistFlows(c *gin.Context) {
+	log := s.log.With("ID", utils.RandomString(29))
+
+	var request GetWatchlistFlowsRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		log.Errorw("invalid request when get watchlist flows", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWatchlist.Error()})
+		return
+	}
+
+	duration, err := util.ParseDuration(request.Duration)
+	if err != nil {
+		log.Errorw("invalid duration when get watchlist flows", "duration", request.Duration, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDuration.Error()})
+		return
+	}
+
+	w, ok := s.getWatchlistOf(c, log)
+	if !ok {
+		return
+	}
+	addrToTokenInfo := s.storage.GetTokenInfo(w.Chain)
+
+	if w.Kind == common.WatchlistKindToken {
+		tradeLogs, err := s.storage.GetTradeLogs(w.Chain, duration)
+		if err != nil {
+			log.Errorw("invalid duration when get watchlist flows", "duration", request.Duration, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		transferLogs, err := s.storage.GetTransferLogs(w.Chain, duration)
+		if err != nil {
+			log.Errorw("invalid duration when get watchlist flows", "duration", request.Duration, "err", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var total WatchlistFlow
+		tokens := make([]WatchlistFlow, 0, len(w.Addresses))
+		for _, addr := range w.Addresses {
+			f := tokenFlow(w.Chain, addr, addrToTokenInfo)
+			key := common.AddressKey(addr)
+			f.BuyInUsdt = tradeLogs.TokenInFlowInUsdt[key]
+			f.SellInUsdt = tradeLogs.TokenOutFlowInUsdt[key]
+			f.Value = f.BuyInUsdt - f.SellInUsdt
+			f.CexInFlowInUsdt = transferLogs.CexInFlowInUsdt[key]
+			f.CexOutFlowInUsdt = transferLogs.CexOutFlowInUsdt[key]
+			f.CexNetFlowInUsdt = f.CexInFlowInUsdt - f.CexOutFlowInUsdt
+			total.add(f)
+			tokens = append(tokens, f)
+		}
+		sortFlows(tokens)
+
+		c.JSON(http.StatusOK, gin.H{
+			"watchlist": w,
+			"tokens":    tokens,
+			"total":     total,
+		})
+		return
+	}
+
+	from := time.Now().Add(-duration)
+	var total WatchlistFlow
+	wallets := make([]WatchlistFlow, 0, len(w.Addresses))
+	byToken := make(map[string]WatchlistFlow)
+	for _, addr := range w.Addresses {
+		wallet := WatchlistFlow{AddressResponse: AddressResponse{Addr: addr, Chain: w.Chain.String()}}
+		if label, exist := s.labels.Get(w.Chain, addr); exist {
+			wallet.Name = label.Name
+		}
+		for _, trade := range s.storage.GetTradeLogsForUser(w.Chain, from, addr) {
+			tokenIn := common.AddressKey(trade.TokenInAddress)
+			tokenOut := common.AddressKey(trade.TokenOutAddress)
+			if !s.storage.IsQuote(w.Chain, tokenOut) {
+				buy := WatchlistFlow{BuyInUsdt: trade.TokenOutAmount * trade.TokenOutUsdtRate}
+				buy.Value = buy.BuyInUsdt
+				wallet.add(buy)
+				addTokenFlow(byToken, tokenOut, buy)
+			}
+			if !s.storage.IsQuote(w.Chain, tokenIn) {
+				sell := WatchlistFlow{SellInUsdt: trade.TokenInAmount * trade.TokenInUsdtRate}
+				sell.Value = -sell.SellInUsdt
+				wallet.add(sell)
+				addTokenFlow(byToken, tokenIn, sell)
+			}
+		}
+		total.add(wallet)
+		wallets = append(wallets, wallet)
+	}
+	sortFlows(wallets)
+
+	tokens := make([]WatchlistFlow, 0, len(byToken))
+	for addr, f := range byToken {
+		token := tokenFlow(w.Chain, addr, addrToTokenInfo)
+		token.add(f)
+		tokens = append(tokens, token)
+	}
+	sortFlows(tokens)
+
+	c.JSON(http.StatusOK, gin.H{
+		"watchlist": w,
+		"wallets":   wallets,
+		"tokens":    tokens,
+		"total":     total,
+	})
+}
+
+func tokenAddressResponse(chain common.Chain, addr string, value float64, addrToTokenInfo map[string]common.Token) TokenAddressResponse {
+	info := addrToTokenInfo[common.AddressKey(addr)]
+	return TokenAddressResponse{
+		AddressResponse: AddressResponse{
+			Addr:  addr,
+			Value: value,
+			Chain: chain.String(),
+		},
+		Symbol:       info.Symbol,
+		CurrentPrice: info.UsdPrice,
+		ImageUrl:     info.ImageUrl,
+	}
+}
+
+func tokenFlow(chain common.Chain, addr string, addrToTokenInfo map[string]common.Token) WatchlistFlow {
+	info := addrToTokenInfo[common.AddressKey(addr)]
+	return WatchlistFlow{
+		AddressResponse: AddressResponse{Addr: addr, Chain: chain.String()},
+		Symbol:          info.Symbol,
+		ImageUrl:        info.ImageUrl,
+	}
+}
+
+func addTokenFlow(flows map[string]WatchlistFlow, token string, f WatchlistFlow) {
+	total := flows[token]
+	total.add(f)
+	flows[token] = total
+}
+
+// sortFlows sorts by net flow desc then address.
+func sortFlows(flows []WatchlistFlow) {
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].Value != flows[j].Value {
+			return flows[i].Value > flows[j].Value
+		}
+		return flows[i].Addr < flows[j].Addr
+	})
+}
@@ -0,0 +1,28 @@
+-- Notify the server when new logs are inserted, the payload is the table name.
+-- Only the default tables of base chain are covered here, with --postgres-notify the server
+-- creates the same trigger for the tables of every chain in the chain config at startup.
+
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION notify_new_logs() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('new_logs', TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+DROP TRIGGER IF EXISTS solana_trade_logs_notify ON solana_trade_logs;
+CREATE TRIGGER solana_trade_logs_notify
+    AFTER INSERT ON solana_trade_logs
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_new_logs();
+
+DROP TRIGGER IF EXISTS solana_transfer_logs_notify ON solana_transfer_logs;
+CREATE TRIGGER solana_transfer_logs_notify
+    AFTER INSERT ON solana_transfer_logs
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_new_logs();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS solana_trade_logs_notify ON solana_trade_logs;
+DROP TRIGGER IF EXISTS solana_transfer_logs_notify ON solana_transfer_logs;
+DROP FUNCTION IF EXISTS notify_new_logs();
@@ -0,0 +1,11 @@
+-- The logs are read page by page in (block_number, log_index) order.
+-- Only the default tables of base chain are covered here, with --postgres-notify the server
+-- creates the same index for the tables of every chain in the chain config at startup.
+
+-- +migrate Up
+CREATE INDEX IF NOT EXISTS solana_trade_logs_position_idx ON solana_trade_logs (block_number, log_index);
+CREATE INDEX IF NOT EXISTS solana_transfer_logs_position_idx ON solana_transfer_logs (block_number, log_index);
+
+-- +migrate Down
+DROP INDEX IF EXISTS solana_trade_logs_position_idx;
+DROP INDEX IF EXISTS solana_transfer_logs_position_idx;
@@ -0,0 +1,22 @@
+-- Alert rules, they are evaluated by the server as the logs are ingested.
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT             NOT NULL,
+    chain       TEXT             NOT NULL,
+    kind        TEXT             NOT NULL,
+    wallet      TEXT             NOT NULL DEFAULT '',
+    token       TEXT             NOT NULL DEFAULT '',
+    duration    TEXT             NOT NULL DEFAULT '',
+    min_usd     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    top_wallets INTEGER          NOT NULL DEFAULT 0,
+    source      TEXT             NOT NULL DEFAULT '',
+    webhook_url TEXT             NOT NULL,
+    secret      TEXT             NOT NULL DEFAULT '',
+    enabled     BOOLEAN          NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS alert_rules;
@@ -0,0 +1,14 @@
+-- Named sets of wallets or tokens, the addresses are lower case.
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS watchlists (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    chain      TEXT        NOT NULL,
+    kind       TEXT        NOT NULL,
+    addresses  TEXT[]      NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS watchlists;
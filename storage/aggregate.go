@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+const (
+	minuteBucket          = time.Minute
+	minuteBucketRetention = time.Hour * 24
+	hourBucket            = time.Hour
+)
+
+// Holding is the net amount of a token and its usd value at the rate of the trades.
+type Holding struct {
+	Amount float64
+	Cost   float64
+}
+
+// profit values the holding at rate.
+func (h Holding) profit(rate float64) float64 {
+	return h.Amount*rate - h.Cost
+}
+
+// TradeAggregate is the sum of trade logs by user and token.
+// Profit is not summed at ingest time, the holdings are kept instead and valued
+// at the current rates by withProfit, so the profit follows the rate updates.
+type TradeAggregate struct {
+	UserHoldings  map[string]map[string]Holding // sender -> token -> holding
+	TokenHoldings map[string]map[string]Holding // token out -> token -> holding
+
+	// UserProfit and TokenProfit are only set on the aggregates returned by withProfit
+	UserProfit  map[string]float64
+	TokenProfit map[string]float64
+
+	TokenInFlowInUsdt map[string]float64
+	TokenInFlow       map[string]float64
+
+	TokenOutFlowInUsdt map[string]float64
+	TokenOutFlow       map[string]float64
+}
+
+func NewTradeAggregate() TradeAggregate {
+	return TradeAggregate{
+		UserHoldings:  make(map[string]map[string]Holding),
+		TokenHoldings: make(map[string]map[string]Holding),
+
+		TokenInFlowInUsdt: make(map[string]float64),
+		TokenInFlow:       make(map[string]float64),
+
+		TokenOutFlowInUsdt: make(map[string]float64),
+		TokenOutFlow:       make(map[string]float64),
+	}
+}
+
+// add adds the log to the aggregate, sign is -1 to remove it.
+func (a TradeAggregate) add(log common.Tradelog, sign float64) {
+	tokenIn := common.AddressKey(log.TokenInAddress)
+	tokenOut := common.AddressKey(log.TokenOutAddress)
+	sender := common.AddressKey(log.Sender)
+
+	// the sender receives token out and pays token in
+	outAmount := sign * log.TokenOutAmount
+	outCost := outAmount * log.TokenOutUsdtRate
+	inAmount := -sign * log.TokenInAmount
+	inCost := inAmount * log.TokenInUsdtRate
+	addHolding(a.UserHoldings, sender, tokenOut, outAmount, outCost)
+	addHolding(a.UserHoldings, sender, tokenIn, inAmount, inCost)
+	addHolding(a.TokenHoldings, tokenOut, tokenOut, outAmount, outCost)
+	addHolding(a.TokenHoldings, tokenOut, tokenIn, inAmount, inCost)
+
+	a.TokenInFlowInUsdt[tokenOut] += sign * log.TokenOutAmount * log.TokenOutUsdtRate
+	a.TokenInFlow[tokenOut] += sign * log.TokenOutAmount
+
+	a.TokenOutFlowInUsdt[tokenIn] += sign * log.TokenInAmount * log.TokenInUsdtRate
+	a.TokenOutFlow[tokenIn] += sign * log.TokenInAmount
+}
+
+// merge adds all values of other to the aggregate.
+func (a TradeAggregate) merge(other TradeAggregate) {
+	mergeHoldings(a.UserHoldings, other.UserHoldings)
+	mergeHoldings(a.TokenHoldings, other.TokenHoldings)
+	mergeFloatMap(a.TokenInFlowInUsdt, other.TokenInFlowInUsdt)
+	mergeFloatMap(a.TokenInFlow, other.TokenInFlow)
+	mergeFloatMap(a.TokenOutFlowInUsdt, other.TokenOutFlowInUsdt)
+	mergeFloatMap(a.TokenOutFlow, other.TokenOutFlow)
+}
+
+// withProfit returns a copy of the aggregate with UserProfit and TokenProfit valued at rates.
+// The holdings of a token without rate are skipped, same as the logs that fail to get the rate.
+func (a TradeAggregate) withProfit(rates map[string]float64) TradeAggregate {
+	a.UserProfit = holdingsProfit(a.UserHoldings, rates)
+	a.TokenProfit = holdingsProfit(a.TokenHoldings, rates)
+	return a
+}
+
+func holdingsProfit(holdings map[string]map[string]Holding, rates map[string]float64) map[string]float64 {
+	res := make(map[string]float64, len(holdings))
+	for key, tokens := range holdings {
+		var profit float64
+		for token, h := range tokens {
+			if rate, exist := rates[token]; exist {
+				profit += h.profit(rate)
+			}
+		}
+		res[key] = profit
+	}
+	return res
+}
+
+func addHolding(holdings map[string]map[string]Holding, key, token string, amount, cost float64) {
+	tokens, exist := holdings[key]
+	if !exist {
+		tokens = make(map[string]Holding)
+		holdings[key] = tokens
+	}
+	h := tokens[token]
+	h.Amount += amount
+	h.Cost += cost
+	tokens[token] = h
+}
+
+func mergeHoldings(dst, src map[string]map[string]Holding) {
+	for key, tokens := range src {
+		for token, h := range tokens {
+			addHolding(dst, key, token, h.Amount, h.Cost)
+		}
+	}
+}
+
+// TransferAggregate is the sum of cex transfer logs by token.
+type TransferAggregate struct {
+	CexInFlow       map[string]float64
+	CexInFlowInUsdt map[string]float64
+
+	CexOutFlow       map[string]float64
+	CexOutFlowInUsdt map[string]float64
+
+	// flows of the transfers that are attributed to an exchange
+	ExchangeFlows map[string]map[string]Flow // exchange -> token -> flow
+}
+
+// Flow is the amount and usd value of a token into and out of an exchange.
+type Flow struct {
+	In        float64
+	InInUsdt  float64
+	Out       float64
+	OutInUsdt float64
+}
+
+// NetInUsdt is the usd value into the exchange minus the usd value out of it.
+func (f Flow) NetInUsdt() float64 {
+	return f.InInUsdt - f.OutInUsdt
+}
+
+func NewTransferAggregate() TransferAggregate {
+	return TransferAggregate{
+		CexInFlow:       make(map[string]float64),
+		CexInFlowInUsdt: make(map[string]float64),
+
+		CexOutFlow:       make(map[string]float64),
+		CexOutFlowInUsdt: make(map[string]float64),
+
+		ExchangeFlows: make(map[string]map[string]Flow),
+	}
+}
+
+// add adds the log to the aggregate, sign is -1 to remove it.
+func (a TransferAggregate) add(log common.Transferlog, sign float64) {
+	token := common.AddressKey(log.TokenAddress)
+	amount := sign * log.TokenAmount
+	var flow Flow
+	if log.IsCexIn {
+		a.CexInFlow[token] += amount
+		a.CexInFlowInUsdt[token] += amount * log.CurrentTokenUsdtRate
+		flow = Flow{In: amount, InInUsdt: amount * log.CurrentTokenUsdtRate}
+	} else {
+		a.CexOutFlow[token] += amount
+		a.CexOutFlowInUsdt[token] += amount * log.CurrentTokenUsdtRate
+		flow = Flow{Out: amount, OutInUsdt: amount * log.CurrentTokenUsdtRate}
+	}
+	if log.Exchange != "" {
+		addFlow(a.ExchangeFlows, log.Exchange, token, flow)
+	}
+	// a transfer between two exchanges is also an outflow of the source one
+	if log.FromExchange != "" {
+		addFlow(a.ExchangeFlows, log.FromExchange, token, Flow{Out: amount, OutInUsdt: amount * log.CurrentTokenUsdtRate})
+	}
+}
+
+// merge adds all values of other to the aggregate.
+func (a TransferAggregate) merge(other TransferAggregate) {
+	mergeFloatMap(a.CexInFlow, other.CexInFlow)
+	mergeFloatMap(a.CexInFlowInUsdt, other.CexInFlowInUsdt)
+	mergeFloatMap(a.CexOutFlow, other.CexOutFlow)
+	mergeFloatMap(a.CexOutFlowInUsdt, other.CexOutFlowInUsdt)
+	for exchange, tokens := range other.ExchangeFlows {
+		for token, f := range tokens {
+			addFlow(a.ExchangeFlows, exchange, token, f)
+		}
+	}
+}
+
+func addFlow(flows map[string]map[string]Flow, exchange, token string, flow Flow) {
+	tokens, exist := flows[exchange]
+	if !exist {
+		tokens = make(map[string]Flow)
+		flows[exchange] = tokens
+	}
+	f := tokens[token]
+	f.In += flow.In
+	f.InInUsdt += flow.InInUsdt
+	f.Out += flow.Out
+	f.OutInUsdt += flow.OutInUsdt
+	tokens[token] = f
+}
+
+func mergeFloatMap(dst, src map[string]float64) {
+	for k, v := range src {
+		dst[k] += v
+	}
+}
+
+type Bucket[A any] struct {
+	Start time.Time
+	Agg   A
+}
+
+// BucketSeries is a time ordered list of aggregates of a fixed size,
+// it is used to answer the ranges that are not preset.
+type BucketSeries[A any] struct {
+	size      time.Duration
+	retention time.Duration
+	newAgg    func() A
+	Buckets   []Bucket[A]
+}
+
+func NewBucketSeries[A any](size, retention time.Duration, newAgg func() A) *BucketSeries[A] {
+	return &BucketSeries[A]{
+		size:      size,
+		retention: retention,
+		newAgg:    newAgg,
+		Buckets:   make([]Bucket[A], 0),
+	}
+}
+
+// get returns the aggregate of the bucket that contains ts, the bucket is created if not exist.
+func (b *BucketSeries[A]) get(ts time.Time) A {
+	start := ts.Truncate(b.size)
+	n := len(b.Buckets)
+	// logs come in block order so the last bucket is the usual case
+	if n > 0 && b.Buckets[n-1].Start.Equal(start) {
+		return b.Buckets[n-1].Agg
+	}
+	if n == 0 || b.Buckets[n-1].Start.Before(start) {
+		b.Buckets = append(b.Buckets, Bucket[A]{Start: start, Agg: b.newAgg()})
+		return b.Buckets[n].Agg
+	}
+
+	i := sort.Search(n, func(i int) bool {
+		return !b.Buckets[i].Start.Before(start)
+	})
+	if i < n && b.Buckets[i].Start.Equal(start) {
+		return b.Buckets[i].Agg
+	}
+	b.Buckets = append(b.Buckets, Bucket[A]{})
+	copy(b.Buckets[i+1:], b.Buckets[i:])
+	b.Buckets[i] = Bucket[A]{Start: start, Agg: b.newAgg()}
+	return b.Buckets[i].Agg
+}
+
+// prune removes the buckets that end before now - retention.
+func (b *BucketSeries[A]) prune(now time.Time) {
+	from := now.Add(-b.retention)
+	i := 0
+	for i < len(b.Buckets) && !b.Buckets[i].Start.Add(b.size).After(from) {
+		i++
+	}
+	if i > 0 {
+		b.Buckets = append(make([]Bucket[A], 0, len(b.Buckets)-i), b.Buckets[i:]...)
+	}
+}
+
+// since returns the aggregates of the buckets that overlap [from, now],
+// so the result can contain up to one bucket size of logs before from.
+func (b *BucketSeries[A]) since(from time.Time) []A {
+	i := sort.Search(len(b.Buckets), func(i int) bool {
+		return b.Buckets[i].Start.Add(b.size).After(from)
+	})
+	res := make([]A, 0, len(b.Buckets)-i)
+	for ; i < len(b.Buckets); i++ {
+		res = append(res, b.Buckets[i].Agg)
+	}
+	return res
+}
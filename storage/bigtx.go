@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// bigTxRetention is how long the big transactions are kept
+var bigTxRetention = maxDuration
+
+// bigTxList is a list of big transactions in block order.
+type bigTxList []*common.BigTx
+
+// insert inserts tx after the transactions of the same or older block.
+func (l bigTxList) insert(tx *common.BigTx) bigTxList {
+	n := len(l)
+	// trades and transfers come in block order so appending is the usual case
+	if n == 0 || l[n-1].BlockNumber <= tx.BlockNumber {
+		return append(l, tx)
+	}
+	i := sort.Search(n, func(i int) bool {
+		return l[i].BlockNumber > tx.BlockNumber
+	})
+	l = append(l, nil)
+	copy(l[i+1:], l[i:])
+	l[i] = tx
+	return l
+}
+
+// prune removes the transactions before from, it expects block timestamps to follow the block order.
+func (l bigTxList) prune(from time.Time) bigTxList {
+	i := 0
+	for i < len(l) && l[i].BlockTimestamp.Before(from) {
+		i++
+	}
+	if i == 0 {
+		return l
+	}
+	// copy to release the old backing array
+	return append(make(bigTxList, 0, len(l)-i), l[i:]...)
+}
+
+// removeFrom removes the transactions from fromBlock that match, it returns the number of removed transactions.
+func (l bigTxList) removeFrom(fromBlock uint64, match func(tx *common.BigTx) bool) (bigTxList, int) {
+	i := sort.Search(len(l), func(i int) bool {
+		return l[i].BlockNumber >= fromBlock
+	})
+	n := i
+	for _, tx := range l[i:] {
+		if !match(tx) {
+			l[n] = tx
+			n++
+		}
+	}
+	return l[:n], len(l) - n
+}
+
+// BigTxCursor is the position of a big transaction, the zero value is after the latest one.
+type BigTxCursor struct {
+	Block uint64
+	Key   string
+}
+
+// BigTxKey identifies a big transaction, a tx can have several big transactions.
+func BigTxKey(tx common.BigTx) string {
+	return tx.Tx + tx.TokenAddress + tx.Sender + tx.Action.String()
+}
+
+// indexOf returns the index of the transaction at the cursor, or the index of the first
+// transaction of the cursor block if it is no longer in the list.
+func (l bigTxList) indexOf(c BigTxCursor) int {
+	if c == (BigTxCursor{}) {
+		return len(l)
+	}
+	end := sort.Search(len(l), func(i int) bool {
+		return l[i].BlockNumber > c.Block
+	})
+	for i := end - 1; i >= 0 && l[i].BlockNumber == c.Block; i-- {
+		if BigTxKey(*l[i]) == c.Key {
+			return i
+		}
+	}
+	return sort.Search(len(l), func(i int) bool {
+		return l[i].BlockNumber >= c.Block
+	})
+}
+
+// last returns up to n latest transactions of action before the cursor.
+func (l bigTxList) last(action common.SmartMoneyActivities, n int, before BigTxCursor) []common.BigTx {
+	res := []common.BigTx{}
+	for i := l.indexOf(before) - 1; i >= 0 && len(res) < n; i-- {
+		if action == common.SmartMoneyActivitiesAll || action == l[i].Action {
+			res = append(res, *l[i])
+		}
+	}
+	return res
+}
+
+// seqOf returns the sequence number of the transaction at the cursor, 0 if it is no longer in the list.
+func (l bigTxList) seqOf(c BigTxCursor) uint64 {
+	i := l.indexOf(c)
+	if i < len(l) && l[i].BlockNumber == c.Block && BigTxKey(*l[i]) == c.Key {
+		return l[i].Seq
+	}
+	return 0
+}
+
+// indexBefore returns the index of the first transaction that is not before the block and seq.
+// The transactions of a block are in the order they are added, so the lists are ordered by block then seq.
+func (l bigTxList) indexBefore(block, seq uint64) int {
+	return sort.Search(len(l), func(i int) bool {
+		return l[i].BlockNumber > block || (l[i].BlockNumber == block && l[i].Seq >= seq)
+	})
+}
+
+// count returns the number of transactions of action.
+func (l bigTxList) count(action common.SmartMoneyActivities) int {
+	if action == common.SmartMoneyActivitiesAll {
+		return len(l)
+	}
+	total := 0
+	for _, tx := range l {
+		if tx.Action == action {
+			total++
+		}
+	}
+	return total
+}
+
+// bigTxStore keeps the big transactions of a chain in block order with indexes by token and sender.
+// The indexes point to the same transactions, they are keyed by address key.
+type bigTxStore struct {
+	txs      bigTxList
+	byToken  map[string]bigTxList
+	bySender map[string]bigTxList
+	// number of transactions by action
+	actions map[common.SmartMoneyActivities]int
+	// seq is the last sequence number, the transactions of older blocks can be added after the new ones
+	// so the stream is resumed by sequence instead of block
+	seq uint64
+	// epoch identifies the numbering of seq, it changes when the numbering restarts without snapshot
+	epoch uint64
+}
+
+func newBigTxStore() *bigTxStore {
+	return &bigTxStore{
+		txs:      make(bigTxList, 0),
+		byToken:  make(map[string]bigTxList),
+		bySender: make(map[string]bigTxList),
+		actions:  make(map[common.SmartMoneyActivities]int),
+		epoch:    uint64(time.Now().UnixNano()),
+	}
+}
+
+func (b *bigTxStore) add(tx common.BigTx) {
+	p := &tx
+	b.txs = b.txs.insert(p)
+	token := common.AddressKey(tx.TokenAddress)
+	b.byToken[token] = b.byToken[token].insert(p)
+	sender := common.AddressKey(tx.Sender)
+	b.bySender[sender] = b.bySender[sender].insert(p)
+	b.actions[tx.Action]++
+	if tx.Seq > b.seq {
+		b.seq = tx.Seq
+	}
+}
+
+// nextSeq returns the sequence number of the next transaction.
+func (b *bigTxStore) nextSeq() uint64 {
+	return b.seq + 1
+}
+
+// prune removes the transactions that are older than the retention.
+func (b *bigTxStore) prune(now time.Time) {
+	from := now.Add(-bigTxRetention)
+	for _, tx := range b.txs {
+		if !tx.BlockTimestamp.Before(from) {
+			break
+		}
+		b.actions[tx.Action]--
+	}
+	b.txs = b.txs.prune(from)
+	pruneBigTxIndex(b.byToken, from)
+	pruneBigTxIndex(b.bySender, from)
+}
+
+func pruneBigTxIndex(index map[string]bigTxList, from time.Time) {
+	for key, l := range index {
+		l = l.prune(from)
+		if len(l) == 0 {
+			delete(index, key)
+			continue
+		}
+		index[key] = l
+	}
+}
+
+// removeFrom removes the transactions of the actions from fromBlock.
+func (b *bigTxStore) removeFrom(fromBlock uint64, actions ...common.SmartMoneyActivities) {
+	match := func(tx *common.BigTx) bool {
+		if tx.BlockNumber < fromBlock {
+			return false
+		}
+		for _, action := range actions {
+			if tx.Action == action {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tx := range b.from(fromBlock) {
+		if match(tx) {
+			b.actions[tx.Action]--
+		}
+	}
+	var removed int
+	b.txs, removed = b.txs.removeFrom(fromBlock, match)
+	if removed == 0 {
+		return
+	}
+	for _, index := range []map[string]bigTxList{b.byToken, b.bySender} {
+		for key, l := range index {
+			l, _ = l.removeFrom(fromBlock, match)
+			if len(l) == 0 {
+				delete(index, key)
+				continue
+			}
+			index[key] = l
+		}
+	}
+}
+
+// last returns up to n latest transactions of action before the cursor and the number of transactions of action.
+func (b *bigTxStore) last(action common.SmartMoneyActivities, n int, before BigTxCursor) ([]common.BigTx, int) {
+	total := len(b.txs)
+	if action != common.SmartMoneyActivitiesAll {
+		total = b.actions[action]
+	}
+	return b.txs.last(action, n, before), total
+}
+
+// lastOf returns up to n latest transactions of action before the cursor in the lists of index of keys, and
+// the number of them. The lists are merged from their ends in the global order so the cursor is the same as
+// the cursor of last.
+func (b *bigTxStore) lastOf(index map[string]bigTxList, keys []string,
+	action common.SmartMoneyActivities, n int, before BigTxCursor) ([]common.BigTx, int) {
+	// the transactions of the cursor block are all after a cursor that is no longer in the list like indexOf
+	seq := b.txs.seqOf(before)
+
+	added := make(map[string]bool, len(keys))
+	total := 0
+	heads := make(bigTxHeads, 0, len(keys))
+	for _, k := range keys {
+		k = common.AddressKey(k)
+		if added[k] {
+			continue
+		}
+		added[k] = true
+		l := index[k]
+		total += l.count(action)
+		end := len(l)
+		if before != (BigTxCursor{}) {
+			end = l.indexBefore(before.Block, seq)
+		}
+		if end > 0 {
+			heads = append(heads, bigTxHead{list: l, i: end - 1})
+		}
+	}
+	heap.Init(&heads)
+
+	res := []common.BigTx{}
+	for len(heads) > 0 && len(res) < n {
+		head := &heads[0]
+		tx := head.list[head.i]
+		if action == common.SmartMoneyActivitiesAll || action == tx.Action {
+			res = append(res, *tx)
+		}
+		if head.i--; head.i < 0 {
+			heap.Pop(&heads)
+		} else {
+			heap.Fix(&heads, 0)
+		}
+	}
+	return res, total
+}
+
+// bigTxHead is the next transaction of a list to merge, the lists are merged from the latest transaction.
+type bigTxHead struct {
+	list bigTxList
+	i    int
+}
+
+// bigTxHeads is a max heap of the heads by block then seq.
+type bigTxHeads []bigTxHead
+
+func (h bigTxHeads) Len() int { return len(h) }
+func (h bigTxHeads) Less(i, j int) bool {
+	a, b := h[i].list[h[i].i], h[j].list[h[j].i]
+	if a.BlockNumber != b.BlockNumber {
+		return a.BlockNumber > b.BlockNumber
+	}
+	return a.Seq > b.Seq
+}
+func (h bigTxHeads) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *bigTxHeads) Push(x interface{}) { *h = append(*h, x.(bigTxHead)) }
+func (h *bigTxHeads) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// from returns the transactions from fromBlock in block order.
+func (b *bigTxStore) from(fromBlock uint64) bigTxList {
+	i := sort.Search(len(b.txs), func(i int) bool {
+		return b.txs[i].BlockNumber >= fromBlock
+	})
+	return b.txs[i:]
+}
+
+// afterSeq returns the transactions with a sequence number after seq in sequence order.
+func (b *bigTxStore) afterSeq(seq uint64) bigTxList {
+	res := bigTxList{}
+	for _, tx := range b.txs {
+		if tx.Seq > seq {
+			res = append(res, tx)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Seq < res[j].Seq
+	})
+	return res
+}
+
+// all returns a copy of all transactions in block order.
+func (b *bigTxStore) all() []common.BigTx {
+	res := make([]common.BigTx, 0, len(b.txs))
+	for _, tx := range b.txs {
+		res = append(res, *tx)
+	}
+	return res
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+type CandleInterval string
+
+const (
+	CandleInterval1m CandleInterval = "1m"
+	CandleInterval5m CandleInterval = "5m"
+	CandleInterval1h CandleInterval = "1h"
+	CandleInterval1d CandleInterval = "1d"
+)
+
+// candleIntervals are the intervals built for every token, with the size and how long they are kept.
+var candleIntervals = []struct {
+	interval  CandleInterval
+	size      time.Duration
+	retention time.Duration
+}{
+	{CandleInterval1m, time.Minute, time.Hour * 24},
+	{CandleInterval5m, time.Minute * 5, time.Hour * 24 * 7},
+	{CandleInterval1h, time.Hour, time.Hour * 24 * 30},
+	{CandleInterval1d, time.Hour * 24, time.Hour * 24 * 365},
+}
+
+func CandleIntervalString(s string) (CandleInterval, error) {
+	for _, c := range candleIntervals {
+		if string(c.interval) == s {
+			return c.interval, nil
+		}
+	}
+	return "", fmt.Errorf("%s does not belong to CandleInterval values", s)
+}
+
+// Retention returns how long the candles of the interval are kept.
+func (i CandleInterval) Retention() time.Duration {
+	for _, c := range candleIntervals {
+		if c.interval == i {
+			return c.retention
+		}
+	}
+	return 0
+}
+
+// Candle is the usd price of a token in [Start, Start + interval), built from the trade rates.
+type Candle struct {
+	Start     time.Time `json:"start"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	Volume    float64   `json:"volume"`
+	VolumeUsd float64   `json:"volume_usd"`
+}
+
+// TokenCandles is the candles of a token, Candles[i] is of candleIntervals[i] and ordered by Start.
+type TokenCandles struct {
+	Candles [][]Candle
+}
+
+func newTokenCandles() *TokenCandles {
+	return &TokenCandles{Candles: make([][]Candle, len(candleIntervals))}
+}
+
+// add adds a trade of amount token at price to the candles that contain ts.
+func (t *TokenCandles) add(ts time.Time, price, amount float64) {
+	for i, c := range candleIntervals {
+		t.Candles[i] = addToCandles(t.Candles[i], ts.Truncate(c.size), price, amount)
+	}
+}
+
+func addToCandles(candles []Candle, start time.Time, price, amount float64) []Candle {
+	n := len(candles)
+	// trades come in block order so the last candle is the usual case
+	i := n - 1
+	if n == 0 || candles[n-1].Start.Before(start) {
+		i = n
+	} else if !candles[n-1].Start.Equal(start) {
+		i = sort.Search(n, func(i int) bool {
+			return !candles[i].Start.Before(start)
+		})
+	}
+	if i == n || !candles[i].Start.Equal(start) {
+		candles = append(candles, Candle{})
+		copy(candles[i+1:], candles[i:])
+		candles[i] = Candle{Start: start, Open: price, High: price, Low: price}
+	}
+
+	c := &candles[i]
+	if price > c.High {
+		c.High = price
+	}
+	if price < c.Low {
+		c.Low = price
+	}
+	c.Close = price
+	c.Volume += amount
+	c.VolumeUsd += amount * price
+	return candles
+}
+
+// prune removes the candles that are out of the retention, it returns false if no candle is left.
+func (t *TokenCandles) prune(now time.Time) bool {
+	left := false
+	for i, c := range candleIntervals {
+		from := now.Add(-c.retention)
+		candles := t.Candles[i]
+		j := 0
+		for j < len(candles) && !candles[j].Start.Add(c.size).After(from) {
+			j++
+		}
+		if j > 0 {
+			t.Candles[i] = append(make([]Candle, 0, len(candles)-j), candles[j:]...)
+		}
+		left = left || len(t.Candles[i]) > 0
+	}
+	return left
+}
+
+// addTradeCandles adds both legs of the trade to the candles of the tokens.
+func (c *ChainData) addTradeCandles(log common.Tradelog) {
+	c.addTokenCandle(common.AddressKey(log.TokenInAddress), log.BlockTimestamp, log.TokenInUsdtRate, log.TokenInAmount)
+	c.addTokenCandle(common.AddressKey(log.TokenOutAddress), log.BlockTimestamp, log.TokenOutUsdtRate, log.TokenOutAmount)
+}
+
+func (c *ChainData) addTokenCandle(token string, ts time.Time, price, amount float64) {
+	if price <= 0 || amount <= 0 {
+		return
+	}
+	candles, exist := c.candles[token]
+	if !exist {
+		candles = newTokenCandles()
+		c.candles[token] = candles
+	}
+	candles.add(ts, price, amount)
+}
+
+func (c *ChainData) pruneCandles(now time.Time) {
+	for token, candles := range c.candles {
+		if !candles.prune(now) {
+			delete(c.candles, token)
+		}
+	}
+}
+
+// GetTokenCandles returns the candles of the token in [from, to] ordered by time.
+func (s *Storage) GetTokenCandles(chain common.Chain, token string, interval CandleInterval, from, to time.Time) []Candle {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	res := []Candle{}
+	candles, exist := s.chains[chain].candles[common.AddressKey(token)]
+	if !exist {
+		return res
+	}
+	for i, c := range candleIntervals {
+		if c.interval != interval {
+			continue
+		}
+		for _, candle := range candles.Candles[i] {
+			if candle.Start.Add(c.size).After(from) && !candle.Start.After(to) {
+				res = append(res, candle)
+			}
+		}
+	}
+	return res
+}
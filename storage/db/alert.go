@@ -0,0 +1,182 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+const alertRuleTable = "alert_rules"
+
+// ErrNotFound is returned when the row to get, update or delete doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+type AlertRuleDB struct {
+	ID         int64     `db:"id"`
+	Name       string    `db:"name"`
+	Chain      string    `db:"chain"`
+	Kind       string    `db:"kind"`
+	Wallet     string    `db:"wallet"`
+	Token      string    `db:"token"`
+	Duration   string    `db:"duration"`
+	MinUsd     float64   `db:"min_usd"`
+	TopWallets int       `db:"top_wallets"`
+	Source     string    `db:"source"`
+	WebhookURL string    `db:"webhook_url"`
+	Secret     string    `db:"secret"`
+	Enabled    bool      `db:"enabled"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func NewAlertRuleDB(r common.AlertRule) AlertRuleDB {
+	var source string
+	if r.Source != 0 {
+		source = r.Source.String()
+	}
+	return AlertRuleDB{
+		ID:         r.ID,
+		Name:       r.Name,
+		Chain:      r.Chain.String(),
+		Kind:       r.Kind.String(),
+		Wallet:     r.Wallet,
+		Token:      r.Token,
+		Duration:   r.Duration,
+		MinUsd:     r.MinUsd,
+		TopWallets: r.TopWallets,
+		Source:     source,
+		WebhookURL: r.WebhookURL,
+		Secret:     r.Secret,
+		Enabled:    r.Enabled,
+		CreatedAt:  r.CreatedAt,
+	}
+}
+
+func (r AlertRuleDB) Convert() (common.AlertRule, error) {
+	chain, err := common.ChainString(r.Chain)
+	if err != nil {
+		return common.AlertRule{}, fmt.Errorf("alert rule %d: %w", r.ID, err)
+	}
+	kind, err := common.AlertKindString(r.Kind)
+	if err != nil {
+		return common.AlertRule{}, fmt.Errorf("alert rule %d: %w", r.ID, err)
+	}
+	var source common.SourcePrice
+	if r.Source != "" {
+		if source, err = common.SourcePriceString(r.Source); err != nil {
+			return common.AlertRule{}, fmt.Errorf("alert rule %d: %w", r.ID, err)
+		}
+	}
+	return common.AlertRule{
+		ID:         r.ID,
+		Name:       r.Name,
+		Chain:      chain,
+		Kind:       kind,
+		Wallet:     r.Wallet,
+		Token:      r.Token,
+		Duration:   r.Duration,
+		MinUsd:     r.MinUsd,
+		TopWallets: r.TopWallets,
+		Source:     source,
+		WebhookURL: r.WebhookURL,
+		Secret:     r.Secret,
+		Enabled:    r.Enabled,
+		CreatedAt:  r.CreatedAt,
+	}, nil
+}
+
+var alertRuleColumns = []string{"name", "chain", "kind", "wallet", "token", "duration",
+	"min_usd", "top_wallets", "source", "webhook_url", "secret", "enabled"}
+
+func (r AlertRuleDB) values() []interface{} {
+	return []interface{}{r.Name, r.Chain, r.Kind, r.Wallet, r.Token, r.Duration,
+		r.MinUsd, r.TopWallets, r.Source, r.WebhookURL, r.Secret, r.Enabled}
+}
+
+func (pg *Postgres) GetAlertRules() ([]common.AlertRule, error) {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select(append([]string{"id", "created_at"}, alertRuleColumns...)...).
+		From(alertRuleTable).OrderBy("id")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rows []AlertRuleDB
+	if err := pg.db.Select(&rows, sql, args...); err != nil {
+		return nil, err
+	}
+
+	rules := make([]common.AlertRule, 0, len(rows))
+	for _, row := range rows {
+		rule, err := row.Convert()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (pg *Postgres) CreateAlertRule(rule common.AlertRule) (common.AlertRule, error) {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert(alertRuleTable).Columns(alertRuleColumns...).Values(NewAlertRuleDB(rule).values()...).
+		Suffix("RETURNING id, created_at")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return common.AlertRule{}, err
+	}
+	if err := pg.db.QueryRow(sql, args...).Scan(&rule.ID, &rule.CreatedAt); err != nil {
+		return common.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+func (pg *Postgres) UpdateAlertRule(rule common.AlertRule) error {
+	row := NewAlertRuleDB(rule)
+	values := row.values()
+	setMap := make(map[string]interface{}, len(alertRuleColumns))
+	for i, column := range alertRuleColumns {
+		setMap[column] = values[i]
+	}
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update(alertRuleTable).SetMap(setMap).Where(sq.Eq{"id": rule.ID})
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	res, err := pg.db.Exec(sql, args...)
+	return rowAffected(res, err)
+}
+
+func (pg *Postgres) DeleteAlertRule(id int64) error {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete(alertRuleTable).Where(sq.Eq{"id": id})
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	res, err := pg.db.Exec(sql, args...)
+	return rowAffected(res, err)
+}
+
+// rowAffected returns ErrNotFound if the statement doesn't change any row.
+func rowAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -1,7 +1,52 @@
 package db
 
+import (
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// LogPosition is the position of a log in a table, the logs are ordered by block number then log index.
+type LogPosition struct {
+	Block    int64
+	LogIndex int64
+}
+
+// BlockStart returns the position before the first log of block.
+func BlockStart(block int64) LogPosition {
+	return LogPosition{Block: block, LogIndex: -1}
+}
+
 type DB interface {
 	GetMaxBlockNumber(table string) (int64, error)
-	GetSolTrades(fromBlock int64, limit uint64) ([]SolanaTradelogDB, error)
-	GetSolTransfer(fromBlock int64, limit uint64) ([]SolanaTransferLogDb, error)
+	// GetBlockRange returns the first and last block of the logs in [from, to], 0 if there is no log
+	GetBlockRange(table string, from, to time.Time) (int64, int64, error)
+	// GetSolTrades returns up to limit trades after the position in log order
+	GetSolTrades(table string, after LogPosition, limit uint64) ([]SolanaTradelogDB, error)
+	// GetSolTransfer returns up to limit transfers after the position in log order
+	GetSolTransfer(table string, after LogPosition, limit uint64) ([]SolanaTransferLogDb, error)
+}
+
+// AlertDB keeps the alert rules.
+type AlertDB interface {
+	GetAlertRules() ([]common.AlertRule, error)
+	// CreateAlertRule returns the rule with its id and creation time
+	CreateAlertRule(rule common.AlertRule) (common.AlertRule, error)
+	// UpdateAlertRule returns ErrNotFound if the rule doesn't exist
+	UpdateAlertRule(rule common.AlertRule) error
+	// DeleteAlertRule returns ErrNotFound if the rule doesn't exist
+	DeleteAlertRule(id int64) error
+}
+
+// WatchlistStore keeps the watchlists.
+type WatchlistStore interface {
+	GetWatchlists() ([]common.Watchlist, error)
+	// GetWatchlist returns ErrNotFound if the watchlist doesn't exist
+	GetWatchlist(id int64) (common.Watchlist, error)
+	// CreateWatchlist returns the watchlist with its id and creation time
+	CreateWatchlist(w common.Watchlist) (common.Watchlist, error)
+	// UpdateWatchlist returns ErrNotFound if the watchlist doesn't exist
+	UpdateWatchlist(w common.Watchlist) error
+	// DeleteWatchlist returns ErrNotFound if the watchlist doesn't exist
+	DeleteWatchlist(id int64) error
 }
@@ -10,6 +10,7 @@ type SolanaTradelogDB struct {
 	BlockTimestamp time.Time `db:"block_timestamp"`
 	BlockNumber    uint64    `db:"block_number"`
 	TxHash         string    `db:"tx_hash"`
+	LogIndex       uint      `db:"log_index"`
 	Sender         string    `db:"sender"`
 
 	TokenInAddress  string  `db:"token_in_address"`
@@ -30,6 +31,7 @@ func (t SolanaTradelogDB) Convert() common.Tradelog {
 		BlockTimestamp: t.BlockTimestamp,
 		BlockNumber:    t.BlockNumber,
 		TxHash:         t.TxHash,
+		LogIndex:       t.LogIndex,
 		Sender:         t.Sender,
 
 		TokenInAddress:  t.TokenInAddress,
@@ -47,6 +49,7 @@ type SolanaTransferLogDb struct {
 	BlockTimestamp time.Time `db:"block_timestamp"`
 	BlockNumber    uint64    `db:"block_number"`
 	TxHash         string    `db:"tx_hash"`
+	LogIndex       uint      `db:"log_index"`
 	FromAddress    string    `db:"from_address"`
 	ToAddress      string    `db:"to_address"`
 
@@ -62,6 +65,7 @@ func (e SolanaTransferLogDb) Convert() common.Transferlog {
 		BlockTimestamp: e.BlockTimestamp,
 		BlockNumber:    e.BlockNumber,
 		TxHash:         e.TxHash,
+		LogIndex:       e.LogIndex,
 		FromAddress:    e.FromAddress,
 		ToAddress:      e.ToAddress,
 		TokenAddress:   e.TokenAddress,
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// NewLogsChannel is the channel notified by the trigger in migrations/schemas with the table name as payload.
+const NewLogsChannel = "new_logs"
+
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = time.Second * 90
+)
+
+// Notifier pushes a signal when new logs are inserted into a table.
+type Notifier interface {
+	// Subscribe returns a channel that receives a signal when logs are inserted into one of the tables,
+	// signals are coalesced so a slow receiver gets at most one pending signal.
+	Subscribe(tables ...string) <-chan struct{}
+	// Connected returns false if notifications may be lost, the receiver should poll instead.
+	Connected() bool
+}
+
+type PgNotifier struct {
+	log       *zap.SugaredLogger
+	listener  *pq.Listener
+	connected atomic.Bool
+
+	mutex sync.Mutex
+	subs  map[string][]chan struct{} // table -> subscribers
+}
+
+// NewPgNotifier listens to NewLogsChannel with a dedicated connection, it reconnects on failure.
+func NewPgNotifier(log *zap.SugaredLogger, connStr string) (*PgNotifier, error) {
+	n := &PgNotifier{
+		log:  log.With("worker", "pgNotifier"),
+		subs: make(map[string][]chan struct{}),
+	}
+	n.listener = pq.NewListener(connStr, listenerMinReconnect, listenerMaxReconnect, n.onEvent)
+	if err := n.listener.Listen(NewLogsChannel); err != nil {
+		n.listener.Close()
+		return nil, err
+	}
+	n.connected.Store(true)
+	return n, nil
+}
+
+func (n *PgNotifier) onEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		n.log.Infow("listener connected", "event", event)
+		n.connected.Store(true)
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		n.log.Warnw("listener disconnected, fallback to polling", "event", event, "err", err)
+		n.connected.Store(false)
+	}
+}
+
+func (n *PgNotifier) Subscribe(tables ...string) <-chan struct{} {
+	c := make(chan struct{}, 1)
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, table := range tables {
+		n.subs[table] = append(n.subs[table], c)
+	}
+	return c
+}
+
+func (n *PgNotifier) Connected() bool {
+	return n.connected.Load()
+}
+
+func (n *PgNotifier) signal(table string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, c := range n.subs[table] {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// signalAll wakes up all subscribers, it is used after a reconnection as notifications may be lost.
+func (n *PgNotifier) signalAll() {
+	n.mutex.Lock()
+	tables := make([]string, 0, len(n.subs))
+	for table := range n.subs {
+		tables = append(tables, table)
+	}
+	n.mutex.Unlock()
+	for _, table := range tables {
+		n.signal(table)
+	}
+}
+
+// Run dispatches the notifications to the subscribers until Close is called.
+func (n *PgNotifier) Run() {
+	for {
+		select {
+		case notification, ok := <-n.listener.Notify:
+			if !ok {
+				return
+			}
+			// nil is sent after a reconnection
+			if notification == nil {
+				n.signalAll()
+				continue
+			}
+			n.signal(notification.Extra)
+		case <-time.After(listenerPingInterval):
+			go func() {
+				if err := n.listener.Ping(); err != nil {
+					n.log.Warnw("listener ping failed", "err", err)
+				}
+			}()
+		}
+	}
+}
+
+func (n *PgNotifier) Close() error {
+	return n.listener.Close()
+}
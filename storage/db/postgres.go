@@ -1,11 +1,14 @@
 package db
 
 import (
+	"time"
+
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // sql driver name: "postgres"
+	"github.com/lib/pq" // sql driver name: "postgres"
 )
 
+// default tables of base chain
 const SolanaTradeTable = "solana_trade_logs"
 const SolanaTransferTable = "solana_transfer_logs"
 
@@ -35,14 +38,38 @@ func (pg *Postgres) GetMaxBlockNumber(table string) (int64, error) {
 	return maxBlock, nil
 }
 
-func (pg *Postgres) GetSolTrades(fromBlock int64, limit uint64) ([]SolanaTradelogDB, error) {
+func (pg *Postgres) GetBlockRange(table string, from, to time.Time) (int64, int64, error) {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("coalesce(min(block_number), 0) AS first", "coalesce(max(block_number), 0) AS last").
+		From(table).Where(sq.GtOrEq{"block_timestamp": from}).Where(sq.LtOrEq{"block_timestamp": to})
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	var blocks struct {
+		First int64 `db:"first"`
+		Last  int64 `db:"last"`
+	}
+	if err := pg.db.Get(&blocks, sql, args...); err != nil {
+		return 0, 0, err
+	}
+	return blocks.First, blocks.Last, nil
+}
+
+// afterPosition selects the logs after the position, it uses the (block_number, log_index) index.
+func afterPosition(after LogPosition) sq.Sqlizer {
+	return sq.Expr("(block_number, log_index) > (?, ?)", after.Block, after.LogIndex)
+}
+
+func (pg *Postgres) GetSolTrades(table string, after LogPosition, limit uint64) ([]SolanaTradelogDB, error) {
 	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
-		Select("block_timestamp", "block_number", "tx_hash", "sender",
+		Select("block_timestamp", "block_number", "tx_hash", "log_index", "sender",
 			"token_in_address", "token_in_amount", "token_in_usdt_rate",
 			"token_out_address", "token_out_amount", "token_out_usdt_rate",
 			"sol_usdt_rate",
 		).
-		From(SolanaTradeTable).OrderBy("block_number").Limit(limit).Where(sq.GtOrEq{"block_number": fromBlock})
+		From(table).OrderBy("block_number", "log_index").Limit(limit).Where(afterPosition(after))
 
 	sql, args, err := query.ToSql()
 	if err != nil {
@@ -58,13 +85,13 @@ func (pg *Postgres) GetSolTrades(fromBlock int64, limit uint64) ([]SolanaTradelo
 	return logs, nil
 }
 
-func (pg *Postgres) GetSolTransfer(fromBlock int64, limit uint64) ([]SolanaTransferLogDb, error) {
+func (pg *Postgres) GetSolTransfer(table string, after LogPosition, limit uint64) ([]SolanaTransferLogDb, error) {
 	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
-		Select("block_timestamp", "block_number", "tx_hash",
+		Select("block_timestamp", "block_number", "tx_hash", "log_index",
 			"from_address", "to_address",
 			"token_address", "token_amount",
 			"is_cex_in",
-		).From(SolanaTransferTable).OrderBy("block_number").Limit(limit).Where(sq.GtOrEq{"block_number": fromBlock})
+		).From(table).OrderBy("block_number", "log_index").Limit(limit).Where(afterPosition(after))
 
 	sql, args, err := query.ToSql()
 	if err != nil {
@@ -79,3 +106,38 @@ func (pg *Postgres) GetSolTransfer(fromBlock int64, limit uint64) ([]SolanaTrans
 
 	return logs, nil
 }
+
+// notifyFunction is the trigger function of migrations/schemas/00001_notify_new_logs.sql.
+const notifyFunction = `CREATE OR REPLACE FUNCTION notify_new_logs() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('new_logs', TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`
+
+// SetupLogTable creates the notify trigger and the position index of a log table, it is idempotent.
+// The migrations only cover the default tables, the tables of the other chains are set up at startup.
+func (pg *Postgres) SetupLogTable(table string) error {
+	name := pq.QuoteIdentifier(table)
+	trigger := pq.QuoteIdentifier(table + "_notify")
+	statements := []string{
+		notifyFunction,
+		"DROP TRIGGER IF EXISTS " + trigger + " ON " + name,
+		"CREATE TRIGGER " + trigger + " AFTER INSERT ON " + name +
+			" FOR EACH STATEMENT EXECUTE FUNCTION notify_new_logs()",
+		"CREATE INDEX IF NOT EXISTS " + pq.QuoteIdentifier(table+"_position_idx") +
+			" ON " + name + " (block_number, log_index)",
+	}
+
+	tx, err := pg.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/lib/pq"
+)
+
+const watchlistTable = "watchlists"
+
+type WatchlistDB struct {
+	ID        int64          `db:"id"`
+	Name      string         `db:"name"`
+	Chain     string         `db:"chain"`
+	Kind      string         `db:"kind"`
+	Addresses pq.StringArray `db:"addresses"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (w WatchlistDB) Convert() (common.Watchlist, error) {
+	chain, err := common.ChainString(w.Chain)
+	if err != nil {
+		return common.Watchlist{}, fmt.Errorf("watchlist %d: %w", w.ID, err)
+	}
+	kind, err := common.WatchlistKindString(w.Kind)
+	if err != nil {
+		return common.Watchlist{}, fmt.Errorf("watchlist %d: %w", w.ID, err)
+	}
+	addresses := []string(w.Addresses)
+	if addresses == nil {
+		addresses = []string{}
+	}
+	return common.Watchlist{
+		ID:        w.ID,
+		Name:      w.Name,
+		Chain:     chain,
+		Kind:      kind,
+		Addresses: addresses,
+		CreatedAt: w.CreatedAt,
+	}, nil
+}
+
+var watchlistColumns = []string{"id", "name", "chain", "kind", "addresses", "created_at"}
+
+func (pg *Postgres) GetWatchlists() ([]common.Watchlist, error) {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select(watchlistColumns...).From(watchlistTable).OrderBy("id")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rows []WatchlistDB
+	if err := pg.db.Select(&rows, sql, args...); err != nil {
+		return nil, err
+	}
+
+	res := make([]common.Watchlist, 0, len(rows))
+	for _, row := range rows {
+		w, err := row.Convert()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, w)
+	}
+	return res, nil
+}
+
+func (pg *Postgres) GetWatchlist(id int64) (common.Watchlist, error) {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select(watchlistColumns...).From(watchlistTable).Where(sq.Eq{"id": id})
+
+	q, args, err := query.ToSql()
+	if err != nil {
+		return common.Watchlist{}, err
+	}
+	var row WatchlistDB
+	if err := pg.db.Get(&row, q, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return common.Watchlist{}, ErrNotFound
+		}
+		return common.Watchlist{}, err
+	}
+	return row.Convert()
+}
+
+func (pg *Postgres) CreateWatchlist(w common.Watchlist) (common.Watchlist, error) {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert(watchlistTable).Columns("name", "chain", "kind", "addresses").
+		Values(w.Name, w.Chain.String(), w.Kind.String(), pq.StringArray(w.Addresses)).
+		Suffix("RETURNING id, created_at")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return common.Watchlist{}, err
+	}
+	if err := pg.db.QueryRow(sql, args...).Scan(&w.ID, &w.CreatedAt); err != nil {
+		return common.Watchlist{}, err
+	}
+	return w, nil
+}
+
+func (pg *Postgres) UpdateWatchlist(w common.Watchlist) error {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update(watchlistTable).
+		Set("name", w.Name).
+		Set("chain", w.Chain.String()).
+		Set("kind", w.Kind.String()).
+		Set("addresses", pq.StringArray(w.Addresses)).
+		Where(sq.Eq{"id": w.ID})
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	res, err := pg.db.Exec(sql, args...)
+	return rowAffected(res, err)
+}
+
+func (pg *Postgres) DeleteWatchlist(id int64) error {
+	query := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete(watchlistTable).Where(sq.Eq{"id": id})
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	res, err := pg.db.Exec(sql, args...)
+	return rowAffected(res, err)
+}
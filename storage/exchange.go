@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// ExchangeFlow is the flow of an exchange in a range.
+type ExchangeFlow struct {
+	Exchange string
+	Flow
+}
+
+// GetExchangeFlows returns the flows of token by exchange in the last duration, ordered by exchange.
+// If token is empty the usd values of all tokens are summed and the amounts are left to 0.
+func (s *Storage) GetExchangeFlows(chain common.Chain, duration time.Duration, token string) ([]ExchangeFlow, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	transfers, err := s.getTransferRange(chain, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	token = common.AddressKey(token)
+	res := make([]ExchangeFlow, 0, len(transfers.ExchangeFlows))
+	for exchange, tokens := range transfers.ExchangeFlows {
+		if token != "" {
+			if f, exist := tokens[token]; exist {
+				res = append(res, ExchangeFlow{Exchange: exchange, Flow: f})
+			}
+			continue
+		}
+		total := ExchangeFlow{Exchange: exchange}
+		for _, f := range tokens {
+			total.InInUsdt += f.InInUsdt
+			total.OutInUsdt += f.OutInUsdt
+		}
+		res = append(res, total)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Exchange < res[j].Exchange
+	})
+	return res, nil
+}
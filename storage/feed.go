@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// bigTxFeedBuffer is the number of events a subscriber can be behind before it is dropped
+const bigTxFeedBuffer = 256
+
+// BigTxFilter selects the big transactions of a subscription, empty fields match all.
+type BigTxFilter struct {
+	Chain  common.Chain
+	Action common.SmartMoneyActivities
+	Token  string
+	Sender string
+}
+
+func (f BigTxFilter) Match(chain common.Chain, tx common.BigTx) bool {
+	if f.Chain != chain {
+		return false
+	}
+	if f.Action != 0 && f.Action != common.SmartMoneyActivitiesAll && f.Action != tx.Action {
+		return false
+	}
+	if f.Token != "" && common.AddressKey(f.Token) != common.AddressKey(tx.TokenAddress) {
+		return false
+	}
+	if f.Sender != "" && common.AddressKey(f.Sender) != common.AddressKey(tx.Sender) {
+		return false
+	}
+	return true
+}
+
+// BigTxSubscription receives the new big transactions that match its filter.
+// C is closed when the subscription is cancelled or the subscriber is too slow,
+// the subscriber should resume from the sequence number of the last received transaction.
+type BigTxSubscription struct {
+	C      <-chan common.BigTx
+	c      chan common.BigTx
+	filter BigTxFilter
+}
+
+type bigTxFeed struct {
+	mutex sync.Mutex
+	subs  map[*BigTxSubscription]struct{}
+}
+
+func newBigTxFeed() *bigTxFeed {
+	return &bigTxFeed{subs: make(map[*BigTxSubscription]struct{})}
+}
+
+func (f *bigTxFeed) publish(chain common.Chain, tx common.BigTx) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for sub := range f.subs {
+		if !sub.filter.Match(chain, tx) {
+			continue
+		}
+		select {
+		case sub.c <- tx:
+		default:
+			// don't block the ingestion for a slow subscriber
+			delete(f.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// SubscribeBigTx subscribes to the new big transactions that match filter.
+// The returned function must be called to release the subscription.
+func (s *Storage) SubscribeBigTx(filter BigTxFilter) (*BigTxSubscription, func()) {
+	c := make(chan common.BigTx, bigTxFeedBuffer)
+	sub := &BigTxSubscription{C: c, c: c, filter: filter}
+
+	s.feed.mutex.Lock()
+	s.feed.subs[sub] = struct{}{}
+	s.feed.mutex.Unlock()
+
+	return sub, func() {
+		s.feed.mutex.Lock()
+		defer s.feed.mutex.Unlock()
+		if _, exist := s.feed.subs[sub]; exist {
+			delete(s.feed.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// BigTxEventID is the position of a big transaction in the stream of a chain. The sequence numbers
+// are only comparable within an epoch, the numbering restarts with a new epoch without snapshot.
+type BigTxEventID struct {
+	Epoch uint64
+	Seq   uint64
+}
+
+func (id BigTxEventID) String() string {
+	return fmt.Sprintf("%d-%d", id.Epoch, id.Seq)
+}
+
+// ParseBigTxEventID parses the id formatted by BigTxEventID.String.
+func ParseBigTxEventID(s string) (BigTxEventID, error) {
+	epoch, seq, found := strings.Cut(s, "-")
+	if !found {
+		return BigTxEventID{}, fmt.Errorf("invalid event id %q", s)
+	}
+	var id BigTxEventID
+	var err error
+	if id.Epoch, err = strconv.ParseUint(epoch, 10, 64); err != nil {
+		return BigTxEventID{}, fmt.Errorf("invalid epoch of event id %q: %w", s, err)
+	}
+	if id.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return BigTxEventID{}, fmt.Errorf("invalid sequence of event id %q: %w", s, err)
+	}
+	return id, nil
+}
+
+// GetBigTxEpoch returns the epoch of the sequence numbers of the chain.
+func (s *Storage) GetBigTxEpoch(chain common.Chain) uint64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.chains[chain].bigTx.epoch
+}
+
+// GetBigTxFromBlock returns the big transactions that match filter from fromBlock in block order,
+// and the last event id. The transactions of a subscription up to this id are already stored.
+func (s *Storage) GetBigTxFromBlock(filter BigTxFilter, fromBlock uint64) ([]common.BigTx, BigTxEventID) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	b := s.chains[filter.Chain].bigTx
+	return matchBigTx(filter, b.from(fromBlock)), BigTxEventID{Epoch: b.epoch, Seq: b.seq}
+}
+
+// GetBigTxAfter returns the big transactions that match filter after the event id in sequence order,
+// and the last event id. It returns false without transactions if the id is of another epoch or is
+// ahead of the last sequence number, the client must then resume by block.
+func (s *Storage) GetBigTxAfter(filter BigTxFilter, after BigTxEventID) ([]common.BigTx, BigTxEventID, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	b := s.chains[filter.Chain].bigTx
+	last := BigTxEventID{Epoch: b.epoch, Seq: b.seq}
+	if after.Epoch != b.epoch || after.Seq > b.seq {
+		return nil, last, false
+	}
+	return matchBigTx(filter, b.afterSeq(after.Seq)), last, true
+}
+
+func matchBigTx(filter BigTxFilter, txs bigTxList) []common.BigTx {
+	res := []common.BigTx{}
+	for _, tx := range txs {
+		if filter.Match(filter.Chain, *tx) {
+			res = append(res, *tx)
+		}
+	}
+	return res
+}
@@ -0,0 +1,45 @@
+package storage
+
+import "sort"
+
+// logIndex maps an address key to the positions of its logs in ascending order.
+// Positions are absolute, they don't change when old logs are compacted.
+type logIndex map[string][]int
+
+func (idx logIndex) add(key string, pos int) {
+	positions := idx[key]
+	if n := len(positions); n > 0 && positions[n-1] == pos {
+		return
+	}
+	idx[key] = append(positions, pos)
+}
+
+// prune removes positions before offset, which are no longer in the logs.
+func (idx logIndex) prune(offset int) {
+	for key, positions := range idx {
+		i := sort.SearchInts(positions, offset)
+		if i == 0 {
+			continue
+		}
+		if i == len(positions) {
+			delete(idx, key)
+			continue
+		}
+		// copy to release the old backing array
+		idx[key] = append(make([]int, 0, len(positions)-i), positions[i:]...)
+	}
+}
+
+// remove removes pos if it is the last position of key, it is used to drop the latest logs.
+func (idx logIndex) remove(key string, pos int) {
+	positions := idx[key]
+	n := len(positions)
+	if n == 0 || positions[n-1] != pos {
+		return
+	}
+	if n == 1 {
+		delete(idx, key)
+		return
+	}
+	idx[key] = positions[:n-1]
+}
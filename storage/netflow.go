@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// GetTokenNetFlow returns the net flow in usdt of each token in the last duration:
+// cex in flow - cex out flow for cex, dex buy - dex sell for dex.
+func (s *Storage) GetTokenNetFlow(chain common.Chain, duration time.Duration, source common.SourcePrice) (map[string]float64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var in, out map[string]float64
+	switch source {
+	case common.SourcePriceCex:
+		transferLogs, err := s.getTransferRange(chain, duration)
+		if err != nil {
+			return nil, err
+		}
+		in, out = transferLogs.CexInFlowInUsdt, transferLogs.CexOutFlowInUsdt
+	case common.SourcePriceDex:
+		tradeLogs, err := s.getTradeRange(chain, duration)
+		if err != nil {
+			return nil, err
+		}
+		in, out = tradeLogs.TokenInFlowInUsdt, tradeLogs.TokenOutFlowInUsdt
+	default:
+		return nil, fmt.Errorf("invalid source %d", source)
+	}
+
+	res := make(map[string]float64, len(in))
+	for token, v := range in {
+		res[token] += v
+	}
+	for token, v := range out {
+		res[token] -= v
+	}
+	return res, nil
+}
+
+// GetCexInFlowInUsdt returns a copy of the cex in flow in usdt of each token in the last duration.
+func (s *Storage) GetCexInFlowInUsdt(chain common.Chain, duration time.Duration) (map[string]float64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	transferLogs, err := s.getTransferRange(chain, duration)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]float64, len(transferLogs.CexInFlowInUsdt))
+	for token, v := range transferLogs.CexInFlowInUsdt {
+		res[token] = v
+	}
+	return res, nil
+}
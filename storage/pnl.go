@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// dustAmount is the amount that is considered as zero after selling
+const dustAmount = 1e-12
+
+// positionRetention is how long the closed positions are kept after their last trade
+var positionRetention = maxDuration
+
+type PnlMethod string
+
+const (
+	PnlMethodFifo    PnlMethod = "fifo"
+	PnlMethodAverage PnlMethod = "avg"
+)
+
+func PnlMethodString(s string) (PnlMethod, error) {
+	switch m := PnlMethod(strings.ToLower(s)); m {
+	case PnlMethodFifo, PnlMethodAverage:
+		return m, nil
+	}
+	return "", fmt.Errorf("%s does not belong to PnlMethod values", s)
+}
+
+// Lot is an amount of token bought at the same price.
+type Lot struct {
+	Amount float64
+	Price  float64
+}
+
+// Position is the holding of a token by a wallet, built from the ingested trades only.
+type Position struct {
+	Amount      float64
+	CostBasis   float64 // usd cost of Amount
+	RealizedPnl float64
+	Lots        []Lot     // only used by fifo method
+	LastTrade   time.Time // block timestamp of the last trade
+}
+
+// Ledger keeps the positions of all wallets, wallets and tokens are keyed by common.AddressKey.
+type Ledger struct {
+	method    PnlMethod
+	Positions map[string]map[string]*Position // wallet -> token -> position
+
+	// the trades of the last depth blocks can be rolled back, 0 to disable
+	depth   uint64
+	journal []ledgerUndo
+}
+
+// ledgerUndo is a position before a trade of block, nil if the position didn't exist.
+type ledgerUndo struct {
+	block    uint64
+	wallet   string
+	token    string
+	position *Position
+}
+
+func NewLedger(method PnlMethod) *Ledger {
+	return &Ledger{
+		method:    method,
+		Positions: make(map[string]map[string]*Position),
+	}
+}
+
+func (l *Ledger) position(wallet, token string) *Position {
+	positions, exist := l.Positions[wallet]
+	if !exist {
+		positions = make(map[string]*Position)
+		l.Positions[wallet] = positions
+	}
+	p, exist := positions[token]
+	if !exist {
+		p = &Position{}
+		positions[token] = p
+	}
+	return p
+}
+
+func (l *Ledger) buy(wallet, token string, amount, price float64) {
+	if amount <= 0 {
+		return
+	}
+	p := l.position(wallet, token)
+	p.Amount += amount
+	p.CostBasis += amount * price
+	if l.method == PnlMethodFifo {
+		p.Lots = append(p.Lots, Lot{Amount: amount, Price: price})
+	}
+}
+
+// sell returns the realized pnl of the sell. Amount that is more than the position is bought
+// before the ingested history, its cost is unknown so it doesn't realize any pnl.
+func (l *Ledger) sell(wallet, token string, amount, price float64) float64 {
+	if amount <= 0 {
+		return 0
+	}
+	p := l.position(wallet, token)
+	matched := amount
+	if matched > p.Amount {
+		matched = p.Amount
+	}
+	if matched <= 0 {
+		return 0
+	}
+
+	var cost float64
+	switch l.method {
+	case PnlMethodFifo:
+		remain := matched
+		for remain > dustAmount && len(p.Lots) > 0 {
+			lot := &p.Lots[0]
+			used := lot.Amount
+			if used > remain {
+				used = remain
+			}
+			cost += used * lot.Price
+			lot.Amount -= used
+			remain -= used
+			if lot.Amount <= dustAmount {
+				p.Lots = p.Lots[1:]
+			}
+		}
+	default:
+		cost = matched * p.CostBasis / p.Amount
+	}
+
+	realized := matched*price - cost
+	p.Amount -= matched
+	p.CostBasis -= cost
+	p.RealizedPnl += realized
+	if p.Amount <= dustAmount {
+		p.Amount = 0
+		p.CostBasis = 0
+		p.Lots = nil
+	}
+	return realized
+}
+
+// addTrade updates the positions of the sender, the sender sells token in and buys token out.
+func (l *Ledger) addTrade(log common.Tradelog) {
+	sender := common.AddressKey(log.Sender)
+	tokenIn := common.AddressKey(log.TokenInAddress)
+	tokenOut := common.AddressKey(log.TokenOutAddress)
+	if l.depth > 0 {
+		l.pruneJournal(log.BlockNumber)
+		l.record(log.BlockNumber, sender, tokenIn)
+		l.record(log.BlockNumber, sender, tokenOut)
+	}
+	l.sell(sender, tokenIn, log.TokenInAmount, log.TokenInUsdtRate)
+	l.buy(sender, tokenOut, log.TokenOutAmount, log.TokenOutUsdtRate)
+	l.touch(sender, tokenIn, log.BlockTimestamp)
+	l.touch(sender, tokenOut, log.BlockTimestamp)
+}
+
+// touch sets the last trade of the position if it exists.
+func (l *Ledger) touch(wallet, token string, ts time.Time) {
+	if p, exist := l.Positions[wallet][token]; exist && ts.After(p.LastTrade) {
+		p.LastTrade = ts
+	}
+}
+
+// prune removes the closed positions whose last trade is before from, it returns the number of removed positions.
+func (l *Ledger) prune(from time.Time) int {
+	removed := 0
+	for wallet, positions := range l.Positions {
+		for token, p := range positions {
+			if p.Amount == 0 && p.LastTrade.Before(from) {
+				delete(positions, token)
+				removed++
+			}
+		}
+		if len(positions) == 0 {
+			delete(l.Positions, wallet)
+		}
+	}
+	return removed
+}
+
+func (l *Ledger) record(block uint64, wallet, token string) {
+	undo := ledgerUndo{block: block, wallet: wallet, token: token}
+	if p, exist := l.Positions[wallet][token]; exist {
+		copied := *p
+		copied.Lots = append([]Lot(nil), p.Lots...)
+		undo.position = &copied
+	}
+	l.journal = append(l.journal, undo)
+}
+
+// pruneJournal drops the records that are deeper than depth from block.
+func (l *Ledger) pruneJournal(block uint64) {
+	i := 0
+	for i < len(l.journal) && l.journal[i].block+l.depth < block {
+		i++
+	}
+	if i > 0 {
+		l.journal = append(make([]ledgerUndo, 0, len(l.journal)-i), l.journal[i:]...)
+	}
+}
+
+// rollback restores the positions before the trades from fromBlock, fromBlock is expected to be in the depth.
+func (l *Ledger) rollback(fromBlock uint64) {
+	n := len(l.journal)
+	for n > 0 && l.journal[n-1].block >= fromBlock {
+		undo := l.journal[n-1]
+		if undo.position == nil {
+			delete(l.Positions[undo.wallet], undo.token)
+			if len(l.Positions[undo.wallet]) == 0 {
+				delete(l.Positions, undo.wallet)
+			}
+		} else {
+			if _, exist := l.Positions[undo.wallet]; !exist {
+				l.Positions[undo.wallet] = make(map[string]*Position)
+			}
+			l.Positions[undo.wallet][undo.token] = undo.position
+		}
+		n--
+	}
+	l.journal = l.journal[:n]
+}
+
+// TokenPnl is the pnl of a wallet for a token at the current rate.
+type TokenPnl struct {
+	Token         string  `json:"token"`
+	Amount        float64 `json:"amount"`
+	CostBasis     float64 `json:"cost_basis"`
+	AvgCost       float64 `json:"avg_cost"`
+	RealizedPnl   float64 `json:"realized_pnl"`
+	UnrealizedPnl float64 `json:"unrealized_pnl"`
+}
+
+// UserPnl is the pnl of a wallet for all tokens at the current rate.
+type UserPnl struct {
+	CostBasis     float64    `json:"cost_basis"`
+	RealizedPnl   float64    `json:"realized_pnl"`
+	UnrealizedPnl float64    `json:"unrealized_pnl"`
+	Tokens        []TokenPnl `json:"tokens,omitempty"`
+}
+
+func (p UserPnl) TotalPnl() float64 {
+	return p.RealizedPnl + p.UnrealizedPnl
+}
+
+// userPnl values the positions of wallet with rates, token without rate has no unrealized pnl.
+func (l *Ledger) userPnl(wallet string, rates map[string]float64, withTokens bool) UserPnl {
+	var res UserPnl
+	for token, p := range l.Positions[wallet] {
+		tokenPnl := TokenPnl{
+			Token:       token,
+			Amount:      p.Amount,
+			CostBasis:   p.CostBasis,
+			RealizedPnl: p.RealizedPnl,
+		}
+		if p.Amount > 0 {
+			tokenPnl.AvgCost = p.CostBasis / p.Amount
+			if rate, exist := rates[token]; exist {
+				tokenPnl.UnrealizedPnl = p.Amount*rate - p.CostBasis
+			}
+		}
+		res.CostBasis += tokenPnl.CostBasis
+		res.RealizedPnl += tokenPnl.RealizedPnl
+		res.UnrealizedPnl += tokenPnl.UnrealizedPnl
+		if withTokens {
+			res.Tokens = append(res.Tokens, tokenPnl)
+		}
+	}
+	sort.Slice(res.Tokens, func(i, j int) bool {
+		return res.Tokens[i].CostBasis > res.Tokens[j].CostBasis
+	})
+	return res
+}
+
+// GetUserPnl returns the pnl of the wallet with pnl of each token.
+func (s *Storage) GetUserPnl(chain common.Chain, wallet string) UserPnl {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data := s.chains[chain]
+	return data.ledger.userPnl(common.AddressKey(wallet), data.tokenUsdtRate, true)
+}
+
+// GetAllUserPnl returns the pnl of all wallets without pnl of each token.
+func (s *Storage) GetAllUserPnl(chain common.Chain) map[string]UserPnl {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data := s.chains[chain]
+	res := make(map[string]UserPnl, len(data.ledger.Positions))
+	for wallet := range data.ledger.Positions {
+		res[wallet] = data.ledger.userPnl(wallet, data.tokenUsdtRate, false)
+	}
+	return res
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/util"
+	"go.uber.org/zap"
+)
+
+const (
+	testWallet = "0xwallet"
+	testToken  = "0xtoken"
+	testQuote  = "0xquote"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+type ledgerOp struct {
+	buy    bool
+	amount float64
+	price  float64
+}
+
+func TestLedgerSell(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       PnlMethod
+		ops          []ledgerOp
+		wantRealized float64
+		wantAmount   float64
+		wantCost     float64
+		wantLots     []Lot
+	}{
+		{
+			name:   "fifo partial sell uses the oldest lots first",
+			method: PnlMethodFifo,
+			ops: []ledgerOp{
+				{buy: true, amount: 10, price: 1},
+				{buy: true, amount: 10, price: 2},
+				{amount: 15, price: 3},
+			},
+			wantRealized: 15*3 - (10*1 + 5*2),
+			wantAmount:   5,
+			wantCost:     5 * 2,
+			wantLots:     []Lot{{Amount: 5, Price: 2}},
+		},
+		{
+			name:   "avg partial sell uses the average cost",
+			method: PnlMethodAverage,
+			ops: []ledgerOp{
+				{buy: true, amount: 10, price: 1},
+				{buy: true, amount: 10, price: 2},
+				{amount: 15, price: 3},
+			},
+			wantRealized: 15*3 - 15*1.5,
+			wantAmount:   5,
+			wantCost:     5 * 1.5,
+		},
+		{
+			name:   "fifo sell above holdings only realizes the held amount",
+			method: PnlMethodFifo,
+			ops: []ledgerOp{
+				{buy: true, amount: 10, price: 1},
+				{amount: 15, price: 3},
+			},
+			wantRealized: 10*3 - 10*1,
+		},
+		{
+			name:   "avg sell above holdings only realizes the held amount",
+			method: PnlMethodAverage,
+			ops: []ledgerOp{
+				{buy: true, amount: 10, price: 1},
+				{amount: 15, price: 3},
+			},
+			wantRealized: 10*3 - 10*1,
+		},
+		{
+			name:   "sell without position has no cost",
+			method: PnlMethodFifo,
+			ops: []ledgerOp{
+				{amount: 5, price: 3},
+			},
+		},
+		{
+			name:   "sell all clears the lots",
+			method: PnlMethodFifo,
+			ops: []ledgerOp{
+				{buy: true, amount: 0.1, price: 3},
+				{buy: true, amount: 0.2, price: 3},
+				{amount: 0.3, price: 4},
+			},
+			wantRealized: 0.3*4 - 0.3*3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLedger(tt.method)
+			var realized float64
+			for _, op := range tt.ops {
+				if op.buy {
+					l.buy(testWallet, testToken, op.amount, op.price)
+				} else {
+					realized += l.sell(testWallet, testToken, op.amount, op.price)
+				}
+			}
+
+			p := l.Positions[testWallet][testToken]
+			if !almostEqual(realized, tt.wantRealized) || !almostEqual(p.RealizedPnl, tt.wantRealized) {
+				t.Errorf("realized pnl = %v, position %v, want %v", realized, p.RealizedPnl, tt.wantRealized)
+			}
+			if !almostEqual(p.Amount, tt.wantAmount) {
+				t.Errorf("amount = %v, want %v", p.Amount, tt.wantAmount)
+			}
+			if !almostEqual(p.CostBasis, tt.wantCost) {
+				t.Errorf("cost basis = %v, want %v", p.CostBasis, tt.wantCost)
+			}
+			if len(p.Lots) != len(tt.wantLots) {
+				t.Fatalf("lots = %v, want %v", p.Lots, tt.wantLots)
+			}
+			for i := range p.Lots {
+				if !almostEqual(p.Lots[i].Amount, tt.wantLots[i].Amount) || !almostEqual(p.Lots[i].Price, tt.wantLots[i].Price) {
+					t.Errorf("lot %d = %v, want %v", i, p.Lots[i], tt.wantLots[i])
+				}
+			}
+		})
+	}
+}
+
+// testTrade returns a trade of testWallet that buys amount of testToken at price with testQuote.
+func testTrade(block uint64, wallet string, amount, price float64) common.Tradelog {
+	return common.Tradelog{
+		BlockTimestamp:   time.Unix(int64(block), 0),
+		BlockNumber:      block,
+		Sender:           wallet,
+		TokenInAddress:   testQuote,
+		TokenInAmount:    amount * price,
+		TokenInUsdtRate:  1,
+		TokenOutAddress:  testToken,
+		TokenOutAmount:   amount,
+		TokenOutUsdtRate: price,
+	}
+}
+
+// testSell returns a trade of wallet that sells amount of testToken at price for testQuote.
+func testSell(block uint64, wallet string, amount, price float64) common.Tradelog {
+	return common.Tradelog{
+		BlockTimestamp:   time.Unix(int64(block), 0),
+		BlockNumber:      block,
+		Sender:           wallet,
+		TokenInAddress:   testToken,
+		TokenInAmount:    amount,
+		TokenInUsdtRate:  price,
+		TokenOutAddress:  testQuote,
+		TokenOutAmount:   amount * price,
+		TokenOutUsdtRate: 1,
+	}
+}
+
+func TestLedgerRollback(t *testing.T) {
+	kept := []common.Tradelog{
+		testTrade(1, testWallet, 10, 1),
+		testTrade(2, testWallet, 10, 2),
+	}
+	rolledBack := []common.Tradelog{
+		testSell(3, testWallet, 15, 3),
+		testTrade(3, "0xother", 5, 3),
+		testTrade(4, testWallet, 1, 4),
+	}
+
+	for _, method := range []PnlMethod{PnlMethodFifo, PnlMethodAverage} {
+		t.Run(string(method), func(t *testing.T) {
+			l := NewLedger(method)
+			l.depth = 10
+			for _, log := range append(append([]common.Tradelog(nil), kept...), rolledBack...) {
+				l.addTrade(log)
+			}
+			l.rollback(3)
+
+			want := NewLedger(method)
+			for _, log := range kept {
+				want.addTrade(log)
+			}
+			if !reflect.DeepEqual(l.Positions, want.Positions) {
+				t.Errorf("positions after rollback = %+v, want %+v", l.Positions, want.Positions)
+			}
+			if len(l.journal) != 2*len(kept) {
+				t.Errorf("journal has %d records, want %d", len(l.journal), 2*len(kept))
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshotOfAverageLedgerWithFifo(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	chains := []common.Chain{common.ChainBase}
+	avg := NewStorage(log, chains, util.NewQuoteRegistry(), util.NewExchangeRegistry(), PnlMethodAverage)
+	avg.chains[common.ChainBase].ledger.addTrade(testTrade(1, testWallet, 10, 1))
+	avg.chains[common.ChainBase].ledger.addTrade(testTrade(2, testWallet, 10, 2))
+	snap := avg.copySnapshot(common.ChainBase, SnapshotBlocks{})
+
+	fifo := NewStorage(log, chains, util.NewQuoteRegistry(), util.NewExchangeRegistry(), PnlMethodFifo)
+	data, err := restoreChainData(fifo.chains[common.ChainBase], snap.Chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.ledger.method != PnlMethodFifo {
+		t.Fatalf("method = %s, want %s", data.ledger.method, PnlMethodFifo)
+	}
+
+	// the average position is one lot at the average cost
+	p := data.ledger.Positions[testWallet][testToken]
+	wantLots := []Lot{{Amount: 20, Price: 1.5}}
+	if !reflect.DeepEqual(p.Lots, wantLots) {
+		t.Fatalf("lots = %v, want %v", p.Lots, wantLots)
+	}
+
+	data.ledger.addTrade(testTrade(3, testWallet, 10, 4))
+	data.ledger.addTrade(testSell(4, testWallet, 25, 5))
+	p = data.ledger.Positions[testWallet][testToken]
+	if want := 25*5 - (20*1.5 + 5*4); !almostEqual(p.RealizedPnl, want) {
+		t.Errorf("realized pnl = %v, want %v", p.RealizedPnl, want)
+	}
+	if !almostEqual(p.Amount, 5) || !almostEqual(p.CostBasis, 5*4) {
+		t.Errorf("position = %+v, want 5 at cost %v", p, 5*4)
+	}
+}
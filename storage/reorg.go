@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// SetConfirmationBlocks sets the number of latest blocks of chain that can be rolled back.
+func (s *Storage) SetConfirmationBlocks(chain common.Chain, depth uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.chains[chain].ledger.depth = depth
+}
+
+// RollbackTrades removes the trade logs from fromBlock and their contributions to the ranges, buckets,
+// positions, candles and big transactions, it returns the number of removed logs.
+// fromBlock is expected to be in the confirmation blocks, the big transactions that were already
+// sent to the subscribers are not recalled.
+func (s *Storage) RollbackTrades(chain common.Chain, fromBlock uint64) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data := s.chains[chain]
+	data.ledger.rollback(fromBlock)
+	data.bigTx.removeFrom(fromBlock, common.SmartMoneyActivitiesBuying, common.SmartMoneyActivitiesSelling)
+
+	n := len(data.tradeLogs)
+	start := sort.Search(n, func(i int) bool {
+		return data.tradeLogs[i].BlockNumber >= fromBlock
+	})
+	if start == n {
+		return 0
+	}
+
+	// earliest timestamp of the removed logs by token
+	tokens := make(map[string]time.Time)
+	for i := n - 1; i >= start; i-- {
+		log := data.tradeLogs[i]
+		pos := data.tradeLogsOffset + i
+		tokenIn := common.AddressKey(log.TokenInAddress)
+		tokenOut := common.AddressKey(log.TokenOutAddress)
+		data.tradeBySender.remove(common.AddressKey(log.Sender), pos)
+		data.tradeByToken.remove(tokenOut, pos)
+		data.tradeByToken.remove(tokenIn, pos)
+
+		for j := range data.tradeDataRange {
+			if r := data.tradeDataRange[j].StartIndex; r != -1 && i >= r {
+				data.tradeDataRange[j].add(log, -1)
+			}
+		}
+		data.tradeMinuteBuckets.get(log.BlockTimestamp).add(log, -1)
+		data.tradeHourBuckets.get(log.BlockTimestamp).add(log, -1)
+		tokens[tokenIn] = log.BlockTimestamp
+		tokens[tokenOut] = log.BlockTimestamp
+	}
+	data.tradeLogs = data.tradeLogs[:start]
+
+	for j := range data.tradeDataRange {
+		r := &data.tradeDataRange[j]
+		if r.StartIndex >= start {
+			r.StartIndex = -1
+		}
+		if start > 0 {
+			r.EndBlockTs = data.tradeLogs[start-1].BlockTimestamp
+			r.EndBlock = data.tradeLogs[start-1].BlockNumber
+		}
+	}
+	for token, from := range tokens {
+		data.rebuildCandles(token, from)
+		data.rebuildTradeSizes(token, from)
+	}
+
+	s.log.Infow("rollback trades", "chain", chain, "fromBlock", fromBlock, "removed", n-start)
+	return n - start
+}
+
+// RollbackTransfers removes the transfer logs from fromBlock and their contributions to the ranges, buckets,
+// deposits, withdraws and big transactions, it returns the number of removed logs.
+func (s *Storage) RollbackTransfers(chain common.Chain, fromBlock uint64) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data := s.chains[chain]
+	data.bigTx.removeFrom(fromBlock, common.SmartMoneyActivitiesDeposit, common.SmartMoneyActivitiesWithdraw)
+
+	n := len(data.transferLogs)
+	start := sort.Search(n, func(i int) bool {
+		return data.transferLogs[i].BlockNumber >= fromBlock
+	})
+	if start == n {
+		return 0
+	}
+
+	for i := n - 1; i >= start; i-- {
+		log := data.transferLogs[i]
+		token := common.AddressKey(log.TokenAddress)
+		data.transferByToken.remove(token, data.transferLogsOffset+i)
+
+		for j := range data.transferDataRange {
+			if r := data.transferDataRange[j].StartIndex; r != -1 && i >= r {
+				data.transferDataRange[j].add(log, -1)
+			}
+		}
+		data.transferMinuteBuckets.get(log.BlockTimestamp).add(log, -1)
+		data.transferHourBuckets.get(log.BlockTimestamp).add(log, -1)
+
+		transfers := data.tokenWithdraw
+		if log.IsCexIn {
+			transfers = data.tokenDeposit
+		}
+		removeTokenTransfer(transfers, token, transferDate(log.BlockTimestamp), log.TokenAmount)
+	}
+	data.transferLogs = data.transferLogs[:start]
+
+	for j := range data.transferDataRange {
+		r := &data.transferDataRange[j]
+		if r.StartIndex >= start {
+			r.StartIndex = -1
+		}
+		if start > 0 {
+			r.EndBlockTs = data.transferLogs[start-1].BlockTimestamp
+			r.EndBlock = data.transferLogs[start-1].BlockNumber
+		}
+	}
+
+	s.log.Infow("rollback transfers", "chain", chain, "fromBlock", fromBlock, "removed", n-start)
+	return n - start
+}
+
+func removeTokenTransfer(transfers map[string]TokenTransfer, token, date string, amount float64) {
+	t, exist := transfers[token]
+	if !exist {
+		return
+	}
+	t[date] -= amount
+	if t[date] <= dustAmount {
+		delete(t, date)
+	}
+	if len(t) == 0 {
+		delete(transfers, token)
+	}
+}
+
+// tradeLegs returns the usd rate and amount of the legs of the trade that are token.
+func tradeLegs(log common.Tradelog, token string) [][2]float64 {
+	var legs [][2]float64
+	if common.AddressKey(log.TokenInAddress) == common.AddressKey(token) {
+		legs = append(legs, [2]float64{log.TokenInUsdtRate, log.TokenInAmount})
+	}
+	if common.AddressKey(log.TokenOutAddress) == common.AddressKey(token) {
+		legs = append(legs, [2]float64{log.TokenOutUsdtRate, log.TokenOutAmount})
+	}
+	return legs
+}
+
+// rebuildCandles rebuilds the candles of token that contain from or are after from with the trade logs,
+// the trade logs are kept longer than the largest candle interval.
+func (c *ChainData) rebuildCandles(token string, from time.Time) {
+	candles, exist := c.candles[token]
+	if !exist {
+		return
+	}
+	starts := make([]time.Time, len(candleIntervals))
+	earliest := from
+	for i, ci := range candleIntervals {
+		starts[i] = from.Truncate(ci.size)
+		if starts[i].Before(earliest) {
+			earliest = starts[i]
+		}
+		l := candles.Candles[i]
+		j := sort.Search(len(l), func(j int) bool {
+			return !l[j].Start.Before(starts[i])
+		})
+		candles.Candles[i] = l[:j]
+	}
+
+	for _, log := range c.tradeLogsOf(token, earliest) {
+		for _, leg := range tradeLegs(log, token) {
+			if leg[0] <= 0 || leg[1] <= 0 {
+				continue
+			}
+			for i, ci := range candleIntervals {
+				if !log.BlockTimestamp.Before(starts[i]) {
+					candles.Candles[i] = addToCandles(candles.Candles[i], log.BlockTimestamp.Truncate(ci.size), leg[0], leg[1])
+				}
+			}
+		}
+	}
+	if !candles.prune(time.Now()) {
+		delete(c.candles, token)
+	}
+}
+
+// rebuildTradeSizes rebuilds the trade sizes of token from from with the trade logs.
+func (c *ChainData) rebuildTradeSizes(token string, from time.Time) {
+	sizes, exist := c.tokenSizes[token]
+	if !exist {
+		return
+	}
+	i := sort.Search(len(sizes.samples), func(i int) bool {
+		return !sizes.samples[i].ts.Before(from)
+	})
+	sizes.samples = sizes.samples[:i]
+	// force to compute the percentile again
+	sizes.computedAt = time.Time{}
+	for _, log := range c.tradeLogsOf(token, from) {
+		if common.AddressKey(log.TokenOutAddress) == common.AddressKey(token) {
+			sizes.add(log.BlockTimestamp, log.TokenOutAmount*log.TokenOutUsdtRate)
+		}
+	}
+}
+
+// tradeLogsOf returns the trade logs of token that are not before from, without revaluing them.
+func (c *ChainData) tradeLogsOf(token string, from time.Time) []common.Tradelog {
+	positions := c.tradeByToken[token]
+	i := sort.Search(len(positions), func(i int) bool {
+		return !c.tradeLogs[positions[i]-c.tradeLogsOffset].BlockTimestamp.Before(from)
+	})
+	logs := make([]common.Tradelog, 0, len(positions)-i)
+	for _, pos := range positions[i:] {
+		logs = append(logs, c.tradeLogs[pos-c.tradeLogsOffset])
+	}
+	return logs
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/util"
+	"go.uber.org/zap"
+)
+
+const testCexWallet = "0xcex"
+
+// reorgTestLogs returns the trades and transfers of the blocks [from, to], a fork changes the senders and amounts.
+func reorgTestLogs(base time.Time, from, to uint64, fork uint64) ([]common.Tradelog, []common.Transferlog) {
+	var (
+		trades    []common.Tradelog
+		transfers []common.Transferlog
+	)
+	for block := from; block <= to; block++ {
+		ts := base.Add(time.Duration(block) * time.Minute)
+		wallet := fmt.Sprintf("0xwallet%d", (block+fork)%3)
+		amount := float64(block + fork*8)
+		tx := fmt.Sprintf("0xtx%d-%d", block, fork)
+
+		buy := testTrade(block, wallet, amount*64, 4)
+		buy.BlockTimestamp, buy.TxHash, buy.LogIndex = ts, tx, 0
+		sell := testSell(block, wallet, amount*16, 8)
+		sell.BlockTimestamp, sell.TxHash, sell.LogIndex = ts, tx, 1
+		trades = append(trades, buy, sell)
+
+		deposit := common.Transferlog{
+			BlockTimestamp:       ts,
+			BlockNumber:          block,
+			TxHash:               tx,
+			LogIndex:             2,
+			FromAddress:          wallet,
+			ToAddress:            testCexWallet,
+			TokenAddress:         testToken,
+			TokenAmount:          amount * 32,
+			CurrentTokenUsdtRate: 4,
+		}
+		withdraw := common.Transferlog{
+			BlockTimestamp:       ts,
+			BlockNumber:          block,
+			TxHash:               tx,
+			LogIndex:             3,
+			FromAddress:          "0xhot",
+			ToAddress:            wallet,
+			TokenAddress:         testToken,
+			TokenAmount:          amount * 8,
+			CurrentTokenUsdtRate: 4,
+		}
+		transfers = append(transfers, deposit, withdraw)
+	}
+	return trades, transfers
+}
+
+func newReorgTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	exchanges := util.NewExchangeRegistry()
+	exchanges.Add(common.ChainBase, "binance", testCexWallet)
+	s := NewStorage(zap.NewNop().Sugar(), []common.Chain{common.ChainBase}, util.NewQuoteRegistry(), exchanges, PnlMethodFifo)
+	s.SetConfirmationBlocks(common.ChainBase, 10)
+	// without percentile rule, the flagged transactions don't depend on the cached percentiles
+	if err := s.SetBigTxThreshold(common.ChainBase, common.BigTxThreshold{MinUsd: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRollbackMatchesCleanIngest(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	const (
+		lastBlock     = 8
+		reorgBlock    = 6
+		newLastBlock  = 9
+		canonicalFork = 1
+	)
+
+	// ingest blocks 1 to 8 in two polls, then blocks 6 to 8 are replaced by the canonical ones and block 9 is added
+	reorged := newReorgTestStorage(t)
+	trades, transfers := reorgTestLogs(base, 1, 4, 0)
+	reorged.AddTradeLogs(common.ChainBase, trades)
+	reorged.AddTransferLogs(common.ChainBase, transfers)
+	trades, transfers = reorgTestLogs(base, 5, lastBlock, 0)
+	reorged.AddTradeLogs(common.ChainBase, trades)
+	reorged.AddTransferLogs(common.ChainBase, transfers)
+
+	if n := reorged.RollbackTrades(common.ChainBase, reorgBlock); n != 2*(lastBlock-reorgBlock+1) {
+		t.Fatalf("rollback removed %d trades, want %d", n, 2*(lastBlock-reorgBlock+1))
+	}
+	if n := reorged.RollbackTransfers(common.ChainBase, reorgBlock); n != 2*(lastBlock-reorgBlock+1) {
+		t.Fatalf("rollback removed %d transfers, want %d", n, 2*(lastBlock-reorgBlock+1))
+	}
+	trades, transfers = reorgTestLogs(base, reorgBlock, newLastBlock, canonicalFork)
+	reorged.AddTradeLogs(common.ChainBase, trades)
+	reorged.AddTransferLogs(common.ChainBase, transfers)
+
+	clean := newReorgTestStorage(t)
+	trades, transfers = reorgTestLogs(base, 1, reorgBlock-1, 0)
+	canonicalTrades, canonicalTransfers := reorgTestLogs(base, reorgBlock, newLastBlock, canonicalFork)
+	clean.AddTradeLogs(common.ChainBase, append(trades, canonicalTrades...))
+	clean.AddTransferLogs(common.ChainBase, append(transfers, canonicalTransfers...))
+
+	got, want := reorged.chains[common.ChainBase], clean.chains[common.ChainBase]
+	if len(want.bigTx.txs) == 0 {
+		t.Fatal("no big transaction, the test doesn't check them")
+	}
+	for _, c := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"trade logs", got.tradeLogs, want.tradeLogs},
+		{"transfer logs", got.transferLogs, want.transferLogs},
+		{"trade ranges", got.tradeDataRange, want.tradeDataRange},
+		{"transfer ranges", got.transferDataRange, want.transferDataRange},
+		{"trade minute buckets", got.tradeMinuteBuckets.Buckets, want.tradeMinuteBuckets.Buckets},
+		{"trade hour buckets", got.tradeHourBuckets.Buckets, want.tradeHourBuckets.Buckets},
+		{"transfer minute buckets", got.transferMinuteBuckets.Buckets, want.transferMinuteBuckets.Buckets},
+		{"transfer hour buckets", got.transferHourBuckets.Buckets, want.transferHourBuckets.Buckets},
+		{"positions", got.ledger.Positions, want.ledger.Positions},
+		{"candles", got.candles, want.candles},
+		{"big transactions", withoutSeq(got.bigTx.all()), withoutSeq(want.bigTx.all())},
+		{"big transaction actions", got.bigTx.actions, want.bigTx.actions},
+		{"token deposits", got.tokenDeposit, want.tokenDeposit},
+		{"token withdraws", got.tokenWithdraw, want.tokenWithdraw},
+	} {
+		if !sameData(reflect.ValueOf(c.got), reflect.ValueOf(c.want)) {
+			t.Errorf("%s after rollback = %+v, want %+v", c.name, c.got, c.want)
+		}
+	}
+}
+
+// withoutSeq clears the sequence numbers, the transactions that are added again get new ones.
+func withoutSeq(txs []common.BigTx) []common.BigTx {
+	for i := range txs {
+		txs[i].Seq = 0
+	}
+	return txs
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// sameData compares the values field by field with a tolerance for floats. A missing map entry
+// and a nil pointer are the same as their zero value, a rollback leaves the zero sums in the maps.
+func sameData(a, b reflect.Value) bool {
+	if a.Type() == timeType {
+		// only the instant, the unexported location may be another pointer
+		return a.FieldByName("wall").Uint() == b.FieldByName("wall").Uint() &&
+			a.FieldByName("ext").Int() == b.FieldByName("ext").Int()
+	}
+	switch a.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return almostEqual(a.Float(), b.Float())
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() == b.Uint()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Ptr:
+		if a.IsNil() && b.IsNil() {
+			return true
+		}
+		ae, be := reflect.Zero(a.Type().Elem()), reflect.Zero(b.Type().Elem())
+		if !a.IsNil() {
+			ae = a.Elem()
+		}
+		if !b.IsNil() {
+			be = b.Elem()
+		}
+		return sameData(ae, be)
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameData(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		keys := append(a.MapKeys(), b.MapKeys()...)
+		for _, k := range keys {
+			av, bv := a.MapIndex(k), b.MapIndex(k)
+			if !av.IsValid() {
+				av = reflect.Zero(a.Type().Elem())
+			}
+			if !bv.IsValid() {
+				bv = reflect.Zero(b.Type().Elem())
+			}
+			if !sameData(av, bv) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !sameData(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	panic(fmt.Sprintf("sameData: unsupported kind %s", a.Kind()))
+}
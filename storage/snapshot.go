@@ -0,0 +1,416 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// snapshotVersion must be increased whenever the layout of snapshot or the keys of its maps change
+const snapshotVersion uint32 = 14
+
+var snapshotMagic = [8]byte{'B', 'A', 'S', 'E', 'S', 'N', 'A', 'P'}
+
+var (
+	ErrSnapshotVersionMismatch = errors.New("snapshot version mismatch")
+	ErrSnapshotTooOld          = errors.New("snapshot is too old")
+)
+
+// SnapshotBlocks is the last processed blocks of a chain at the time the snapshot is written.
+type SnapshotBlocks struct {
+	LastTradeBlock    int64
+	LastTransferBlock int64
+}
+
+type tradeRangeSnapshot struct {
+	Duration time.Duration
+	TradeStorageByRange
+}
+
+type transferRangeSnapshot struct {
+	Duration time.Duration
+	TransferStorageByRange
+}
+
+type chainSnapshot struct {
+	Network           common.Chain
+	TradeLogs         []common.Tradelog
+	TransferLogs      []common.Transferlog
+	TradeDataRange    []tradeRangeSnapshot
+	TransferDataRange []transferRangeSnapshot
+	Tokens            map[string]bool
+	BigTx             []common.BigTx
+	BigTxEpoch        uint64
+	TokenDeposit      map[string]TokenTransfer
+	TokenWithdraw     map[string]TokenTransfer
+	Blocks            SnapshotBlocks
+
+	TradeMinuteBuckets    []Bucket[TradeAggregate]
+	TradeHourBuckets      []Bucket[TradeAggregate]
+	TransferMinuteBuckets []Bucket[TransferAggregate]
+	TransferHourBuckets   []Bucket[TransferAggregate]
+
+	Positions map[string]map[string]*Position
+	Candles   map[string]*TokenCandles
+}
+
+type snapshot struct {
+	CreatedAt time.Time
+	Chain     chainSnapshot
+}
+
+// WriteSnapshot writes the data of chain to path. The data is copied under the read lock
+// and encoded outside of it, the file is replaced atomically.
+func (s *Storage) WriteSnapshot(path string, chain common.Chain, blocks SnapshotBlocks) error {
+	snap := s.copySnapshot(chain, blocks)
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("create snapshot file: %w", err)
+	}
+	defer os.Remove(tmpPath) // no-op after rename
+
+	if err := encodeSnapshot(f, snap); err != nil {
+		f.Close()
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync snapshot file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close snapshot file: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadSnapshot replaces the data of chain with the content of the snapshot at path
+// and returns the last processed blocks of the chain.
+// The storage is left untouched if the snapshot is corrupted, has another version
+// or its last trade block is before minTradeBlock.
+func (s *Storage) LoadSnapshot(path string, chain common.Chain, minTradeBlock int64) (SnapshotBlocks, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SnapshotBlocks{}, fmt.Errorf("open snapshot file: %w", err)
+	}
+	defer f.Close()
+
+	snap, err := decodeSnapshot(f)
+	if err != nil {
+		return SnapshotBlocks{}, err
+	}
+	if snap.Chain.Network != chain {
+		return SnapshotBlocks{}, fmt.Errorf("snapshot is of chain %s, expected %s", snap.Chain.Network, chain)
+	}
+	if snap.Chain.Blocks.LastTradeBlock < minTradeBlock {
+		return SnapshotBlocks{}, fmt.Errorf("%w: last trade block %d, expected at least %d",
+			ErrSnapshotTooOld, snap.Chain.Blocks.LastTradeBlock, minTradeBlock)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.restoreSnapshot(snap); err != nil {
+		return SnapshotBlocks{}, err
+	}
+	s.log.Infow("loaded snapshot", "path", path, "chain", chain, "created_at", snap.CreatedAt, "blocks", snap.Chain.Blocks)
+	return snap.Chain.Blocks, nil
+}
+
+// QueueSnapshot reads a snapshot of chain from r, it replaces the data of chain on the next call of
+// RestoreQueuedSnapshot by the ingestion worker. It returns the last processed blocks of the snapshot.
+func (s *Storage) QueueSnapshot(chain common.Chain, r io.Reader) (SnapshotBlocks, error) {
+	snap, err := decodeSnapshot(r)
+	if err != nil {
+		return SnapshotBlocks{}, err
+	}
+	if snap.Chain.Network != chain {
+		return SnapshotBlocks{}, fmt.Errorf("snapshot is of chain %s, expected %s", snap.Chain.Network, chain)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queuedSnapshots[chain] = &snap
+	return snap.Chain.Blocks, nil
+}
+
+// RestoreQueuedSnapshot replaces the data of chain with the queued snapshot and returns its last processed blocks,
+// it returns false if no snapshot is queued.
+func (s *Storage) RestoreQueuedSnapshot(chain common.Chain) (SnapshotBlocks, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snap, exist := s.queuedSnapshots[chain]
+	if !exist {
+		return SnapshotBlocks{}, false, nil
+	}
+	delete(s.queuedSnapshots, chain)
+	if err := s.restoreSnapshot(*snap); err != nil {
+		return SnapshotBlocks{}, false, err
+	}
+	s.log.Infow("restored queued snapshot", "chain", chain, "created_at", snap.CreatedAt, "blocks", snap.Chain.Blocks)
+	return snap.Chain.Blocks, true, nil
+}
+
+// restoreSnapshot replaces the data of the snapshot chain, the caller must hold the lock.
+func (s *Storage) restoreSnapshot(snap snapshot) error {
+	chain := snap.Chain.Network
+
+	current := s.chains[chain]
+	data, err := restoreChainData(current, snap.Chain)
+	if err != nil {
+		return err
+	}
+	// token info and rates are refreshed by the rate worker, keep the current one
+	data.addrToTokenInfo = current.addrToTokenInfo
+	data.tokenUsdtRate = current.tokenUsdtRate
+	// thresholds are from the config
+	data.bigTxThreshold = current.bigTxThreshold
+	s.chains[chain] = data
+	return nil
+}
+
+func (s *Storage) copySnapshot(chain common.Chain, blocks SnapshotBlocks) snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data := s.chains[chain]
+	c := chainSnapshot{
+		Network:       chain,
+		TradeLogs:     append([]common.Tradelog(nil), data.tradeLogs...),
+		TransferLogs:  append([]common.Transferlog(nil), data.transferLogs...),
+		Tokens:        make(map[string]bool, len(data.tokens)),
+		BigTx:         data.bigTx.all(),
+		BigTxEpoch:    data.bigTx.epoch,
+		TokenDeposit:  copyTokenTransfers(data.tokenDeposit),
+		TokenWithdraw: copyTokenTransfers(data.tokenWithdraw),
+		Blocks:        blocks,
+
+		TradeMinuteBuckets:    copyBuckets(data.tradeMinuteBuckets.Buckets, NewTradeAggregate),
+		TradeHourBuckets:      copyBuckets(data.tradeHourBuckets.Buckets, NewTradeAggregate),
+		TransferMinuteBuckets: copyBuckets(data.transferMinuteBuckets.Buckets, NewTransferAggregate),
+		TransferHourBuckets:   copyBuckets(data.transferHourBuckets.Buckets, NewTransferAggregate),
+
+		Positions: copyPositions(data.ledger.Positions),
+		Candles:   copyCandles(data.candles),
+	}
+	for k, v := range data.tokens {
+		c.Tokens[k] = v
+	}
+	for _, r := range data.tradeDataRange {
+		c.TradeDataRange = append(c.TradeDataRange, tradeRangeSnapshot{
+			Duration:            r.duration,
+			TradeStorageByRange: copyTradeStorageByRange(r),
+		})
+	}
+	for _, r := range data.transferDataRange {
+		c.TransferDataRange = append(c.TransferDataRange, transferRangeSnapshot{
+			Duration:               r.duration,
+			TransferStorageByRange: copyTransferStorageByRange(r),
+		})
+	}
+	return snapshot{CreatedAt: time.Now(), Chain: c}
+}
+
+func restoreChainData(current *ChainData, c chainSnapshot) (*ChainData, error) {
+	if len(c.TradeDataRange) != len(current.tradeDataRange) ||
+		len(c.TransferDataRange) != len(current.transferDataRange) {
+		return nil, fmt.Errorf("snapshot ranges of chain %s do not match the configured ranges", c.Network)
+	}
+
+	data := newChainData(c.Network, current.ledger.method)
+	data.ledger.Positions = copyPositions(c.Positions)
+	// the trades of the snapshot can't be rolled back, only the new ones are in the journal
+	data.ledger.depth = current.ledger.depth
+	if data.ledger.method == PnlMethodFifo {
+		// the snapshot may be written with average method, keep the held amount as one lot
+		for _, positions := range data.ledger.Positions {
+			for _, p := range positions {
+				if p.Amount > 0 && len(p.Lots) == 0 {
+					p.Lots = []Lot{{Amount: p.Amount, Price: p.CostBasis / p.Amount}}
+				}
+			}
+		}
+	}
+	data.candles = copyCandles(c.Candles)
+	data.tokenDeposit = copyTokenTransfers(c.TokenDeposit)
+	data.tokenWithdraw = copyTokenTransfers(c.TokenWithdraw)
+	if c.TradeLogs != nil {
+		data.tradeLogs = c.TradeLogs
+	}
+	if c.TransferLogs != nil {
+		data.transferLogs = c.TransferLogs
+	}
+	for _, tx := range c.BigTx {
+		data.bigTx.add(tx)
+	}
+	// the stream clients resume by sequence of the snapshot epoch, don't reuse the numbers already sent
+	data.bigTx.epoch = c.BigTxEpoch
+	if current.bigTx.seq > data.bigTx.seq {
+		data.bigTx.seq = current.bigTx.seq
+	}
+	// indexes and trade sizes are not in the snapshot, rebuild them from the logs
+	from := time.Now().Add(-percentileWindow)
+	for i, log := range data.tradeLogs {
+		data.indexTradeLog(i)
+		if !log.BlockTimestamp.Before(from) {
+			data.addTradeSize(log)
+		}
+	}
+	for i := range data.transferLogs {
+		data.indexTransferLog(i)
+	}
+	data.tradeMinuteBuckets.Buckets = copyBuckets(c.TradeMinuteBuckets, NewTradeAggregate)
+	data.tradeHourBuckets.Buckets = copyBuckets(c.TradeHourBuckets, NewTradeAggregate)
+	data.transferMinuteBuckets.Buckets = copyBuckets(c.TransferMinuteBuckets, NewTransferAggregate)
+	data.transferHourBuckets.Buckets = copyBuckets(c.TransferHourBuckets, NewTransferAggregate)
+	for k, v := range c.Tokens {
+		data.tokens[k] = v
+	}
+
+	for i, r := range c.TradeDataRange {
+		if r.Duration != current.tradeDataRange[i].duration {
+			return nil, fmt.Errorf("snapshot trade range %s of chain %s does not match the configured ranges", r.Duration, c.Network)
+		}
+		// gob decodes empty maps as nil, copy into initialized maps
+		r.TradeStorageByRange.duration = r.Duration
+		data.tradeDataRange[i] = copyTradeStorageByRange(r.TradeStorageByRange)
+	}
+	for i, r := range c.TransferDataRange {
+		if r.Duration != current.transferDataRange[i].duration {
+			return nil, fmt.Errorf("snapshot transfer range %s of chain %s does not match the configured ranges", r.Duration, c.Network)
+		}
+		r.TransferStorageByRange.duration = r.Duration
+		data.transferDataRange[i] = copyTransferStorageByRange(r.TransferStorageByRange)
+	}
+	return data, nil
+}
+
+func encodeSnapshot(w io.Writer, snap snapshot) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotMagic[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.BigEndian, snapshotVersion); err != nil {
+		return err
+	}
+	// gzip stores a crc32 of the content, so a truncated or corrupted file fails to decode
+	zw := gzip.NewWriter(bw)
+	if err := gob.NewEncoder(zw).Encode(snap); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func decodeSnapshot(r io.Reader) (snapshot, error) {
+	br := bufio.NewReader(r)
+	var magic [8]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return snapshot{}, fmt.Errorf("read snapshot header: %w", err)
+	}
+	if magic != snapshotMagic {
+		return snapshot{}, fmt.Errorf("invalid snapshot header")
+	}
+	var version uint32
+	if err := binary.Read(br, binary.BigEndian, &version); err != nil {
+		return snapshot{}, fmt.Errorf("read snapshot version: %w", err)
+	}
+	if version != snapshotVersion {
+		return snapshot{}, fmt.Errorf("%w: got %d, expected %d", ErrSnapshotVersionMismatch, version, snapshotVersion)
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("read snapshot: %w", err)
+	}
+	var snap snapshot
+	if err := gob.NewDecoder(zr).Decode(&snap); err != nil {
+		return snapshot{}, fmt.Errorf("decode snapshot: %w", err)
+	}
+	// read until EOF to verify the checksum
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return snapshot{}, fmt.Errorf("verify snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+func copyTokenTransfers(m map[string]TokenTransfer) map[string]TokenTransfer {
+	res := make(map[string]TokenTransfer, len(m))
+	for token, transfers := range m {
+		t := make(TokenTransfer, len(transfers))
+		for date, v := range transfers {
+			t[date] = v
+		}
+		res[token] = t
+	}
+	return res
+}
+
+func copyPositions(m map[string]map[string]*Position) map[string]map[string]*Position {
+	res := make(map[string]map[string]*Position, len(m))
+	for wallet, positions := range m {
+		p := make(map[string]*Position, len(positions))
+		for token, position := range positions {
+			copied := *position
+			copied.Lots = append([]Lot(nil), position.Lots...)
+			p[token] = &copied
+		}
+		res[wallet] = p
+	}
+	return res
+}
+
+func copyCandles(m map[string]*TokenCandles) map[string]*TokenCandles {
+	res := make(map[string]*TokenCandles, len(m))
+	for token, candles := range m {
+		t := newTokenCandles()
+		// the number of intervals of the snapshot is checked by the version
+		for i := range t.Candles {
+			if i < len(candles.Candles) {
+				t.Candles[i] = append([]Candle(nil), candles.Candles[i]...)
+			}
+		}
+		res[token] = t
+	}
+	return res
+}
+
+type mergeable[A any] interface {
+	merge(other A)
+}
+
+// copyBuckets deep copies the buckets, it also makes sure all maps are initialized after gob decoding.
+func copyBuckets[A mergeable[A]](buckets []Bucket[A], newAgg func() A) []Bucket[A] {
+	res := make([]Bucket[A], 0, len(buckets))
+	for _, b := range buckets {
+		agg := newAgg()
+		agg.merge(b.Agg)
+		res = append(res, Bucket[A]{Start: b.Start, Agg: agg})
+	}
+	return res
+}
+
+func copyTradeStorageByRange(r TradeStorageByRange) TradeStorageByRange {
+	res := NewTradeStorageByRange(r.duration)
+	res.merge(r.TradeAggregate)
+	res.StorageByRangeIndex = r.StorageByRangeIndex
+	return res
+}
+
+func copyTransferStorageByRange(r TransferStorageByRange) TransferStorageByRange {
+	res := NewTransferStorageByRange(r.duration)
+	res.merge(r.TransferAggregate)
+	res.StorageByRangeIndex = r.StorageByRangeIndex
+	return res
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/kv-base-hack/base-server-api/common"
 	"github.com/kv-base-hack/base-server-api/lib/coingecko"
@@ -13,8 +14,6 @@ import (
 	"go.uber.org/zap"
 )
 
-const bigVolumeInUsdt = 50_000
-
 type StorageByRangeIndex struct {
 	StartIndex   int       // point to first trade logs of this chain that in duration
 	StartBlockTs time.Time // use to debug, blockTs of StartIndex block
@@ -26,26 +25,14 @@ type StorageByRangeIndex struct {
 type TradeStorageByRange struct {
 	duration time.Duration
 
-	UserProfit  map[string]float64
-	TokenProfit map[string]float64
-
-	TokenInFlowInUsdt map[string]float64
-	TokenInFlow       map[string]float64
-
-	TokenOutFlowInUsdt map[string]float64
-	TokenOutFlow       map[string]float64
+	TradeAggregate
 	StorageByRangeIndex
 }
 
 type TransferStorageByRange struct {
 	duration time.Duration
 
-	CexInFlow       map[string]float64
-	CexInFlowInUsdt map[string]float64
-
-	CexOutFlow       map[string]float64
-	CexOutFlowInUsdt map[string]float64
-
+	TransferAggregate
 	StorageByRangeIndex
 }
 
@@ -53,31 +40,46 @@ type TransferStorageByRange struct {
 type TokenTransfer map[string]float64
 
 type ChainData struct {
-	network           common.Chain
+	network common.Chain
+	// keyed by common.AddressKey of the token
+	tokenUsdtRate     map[string]float64
 	tradeLogs         []common.Tradelog
 	transferLogs      []common.Transferlog
 	addrToTokenInfo   map[string]common.Token
 	tradeDataRange    []TradeStorageByRange
 	transferDataRange []TransferStorageByRange
 	tokens            map[string]bool
-	bigTx             []common.BigTx
+	bigTx             *bigTxStore
 	tokenDeposit      map[string]TokenTransfer
 	tokenWithdraw     map[string]TokenTransfer
-}
 
-func NewTradeStorageByRange(duration time.Duration) TradeStorageByRange {
-	return TradeStorageByRange{
-		duration: duration, // 1h
+	// number of logs dropped by CompactLogs, position of tradeLogs[i] is tradeLogsOffset + i
+	tradeLogsOffset    int
+	transferLogsOffset int
+	tradeBySender      logIndex
+	tradeByToken       logIndex
+	transferByToken    logIndex
 
-		UserProfit:  make(map[string]float64),
-		TokenProfit: make(map[string]float64),
+	// positions of all wallets from the ingested trades
+	ledger *Ledger
+	// keyed by common.AddressKey of the token
+	candles map[string]*TokenCandles
 
-		TokenInFlowInUsdt: make(map[string]float64),
-		TokenInFlow:       make(map[string]float64),
+	bigTxThreshold common.BigTxThreshold
+	// keyed by common.AddressKey of the token
+	tokenSizes map[string]*tokenSizes
 
-		TokenOutFlowInUsdt: make(map[string]float64),
-		TokenOutFlow:       make(map[string]float64),
+	// buckets answer the ranges that are not in tradeDataRange and transferDataRange
+	tradeMinuteBuckets    *BucketSeries[TradeAggregate]
+	tradeHourBuckets      *BucketSeries[TradeAggregate]
+	transferMinuteBuckets *BucketSeries[TransferAggregate]
+	transferHourBuckets   *BucketSeries[TransferAggregate]
+}
 
+func NewTradeStorageByRange(duration time.Duration) TradeStorageByRange {
+	return TradeStorageByRange{
+		duration:       duration, // 1h
+		TradeAggregate: NewTradeAggregate(),
 		StorageByRangeIndex: StorageByRangeIndex{
 			StartIndex: -1,
 		},
@@ -86,94 +88,216 @@ func NewTradeStorageByRange(duration time.Duration) TradeStorageByRange {
 
 func NewTransferStorageByRange(duration time.Duration) TransferStorageByRange {
 	return TransferStorageByRange{
-		duration:        duration,
-		CexInFlow:       make(map[string]float64),
-		CexInFlowInUsdt: make(map[string]float64),
-
-		CexOutFlow:       make(map[string]float64),
-		CexOutFlowInUsdt: make(map[string]float64),
-
+		duration:          duration,
+		TransferAggregate: NewTransferAggregate(),
 		StorageByRangeIndex: StorageByRangeIndex{
 			StartIndex: -1,
 		},
 	}
 }
 
+// presetDurations are the ranges that are kept up to date on every log, other ranges are computed from buckets.
+var presetDurations = []time.Duration{
+	time.Hour,
+	time.Hour * 4,
+	time.Hour * 24,      // 1 day
+	time.Hour * 24 * 7,  // 1 week
+	time.Hour * 24 * 30, // 1 month
+}
+
+// maxDuration is the longest range that can be queried, older logs are removed.
+var maxDuration = presetDurations[len(presetDurations)-1]
+
+func newChainData(network common.Chain, pnlMethod PnlMethod) *ChainData {
+	data := &ChainData{
+		network:         network,
+		tokenUsdtRate:   make(map[string]float64),
+		tradeLogs:       make([]common.Tradelog, 0),
+		transferLogs:    make([]common.Transferlog, 0),
+		addrToTokenInfo: make(map[string]common.Token),
+		tokens:          make(map[string]bool),
+		bigTx:           newBigTxStore(),
+		tokenDeposit:    make(map[string]TokenTransfer),
+		tokenWithdraw:   make(map[string]TokenTransfer),
+		tradeBySender:   make(logIndex),
+		tradeByToken:    make(logIndex),
+		transferByToken: make(logIndex),
+		ledger:          NewLedger(pnlMethod),
+		candles:         make(map[string]*TokenCandles),
+		bigTxThreshold:  common.BigTxThreshold{MinUsd: DefaultBigTxMinUsd},
+		tokenSizes:      make(map[string]*tokenSizes),
+
+		tradeMinuteBuckets:    NewBucketSeries(minuteBucket, minuteBucketRetention, NewTradeAggregate),
+		tradeHourBuckets:      NewBucketSeries(hourBucket, maxDuration, NewTradeAggregate),
+		transferMinuteBuckets: NewBucketSeries(minuteBucket, minuteBucketRetention, NewTransferAggregate),
+		transferHourBuckets:   NewBucketSeries(hourBucket, maxDuration, NewTransferAggregate),
+	}
+	for _, d := range presetDurations {
+		data.tradeDataRange = append(data.tradeDataRange, NewTradeStorageByRange(d))
+		data.transferDataRange = append(data.transferDataRange, NewTransferStorageByRange(d))
+	}
+	return data
+}
+
 type Storage struct {
-	log   *zap.SugaredLogger
-	mutex sync.RWMutex
-	// we lower case all token in this map
-	tokenUsdtRate  map[string]float64
+	log            *zap.SugaredLogger
+	mutex          sync.RWMutex
 	trendingTokens coingecko.CoingeckoTrending
 	symbolToInfo   map[string]common.CmcTokenInfo
 	chains         map[common.Chain]*ChainData
+	quotes         *util.QuoteRegistry
+	exchanges      *util.ExchangeRegistry
+	feed           *bigTxFeed
+	hooks          Hooks
+	// snapshots uploaded to a running server, restored by the ingestion worker
+	queuedSnapshots map[common.Chain]*snapshot
+}
+
+func NewStorage(log *zap.SugaredLogger, chains []common.Chain, quotes *util.QuoteRegistry,
+	exchanges *util.ExchangeRegistry, pnlMethod PnlMethod) *Storage {
+	chainData := make(map[common.Chain]*ChainData, len(chains))
+	for _, chain := range chains {
+		chainData[chain] = newChainData(chain, pnlMethod)
+	}
+	return &Storage{
+		log:          log,
+		chains:       chainData,
+		symbolToInfo: make(map[string]common.CmcTokenInfo),
+		quotes:       quotes,
+		exchanges:    exchanges,
+		feed:         newBigTxFeed(),
+
+		queuedSnapshots: make(map[common.Chain]*snapshot),
+	}
 }
 
-func NewStorage(log *zap.SugaredLogger) *Storage {
-	baseTradeDataByRange := []TradeStorageByRange{
-		NewTradeStorageByRange(time.Hour),
-		NewTradeStorageByRange(time.Hour * 4),
-		NewTradeStorageByRange(time.Hour * 24),      // 1 day
-		NewTradeStorageByRange(time.Hour * 24 * 7),  // 1 week
-		NewTradeStorageByRange(time.Hour * 24 * 30), // 1 month
-	}
+// Hooks are called by storage under its lock as the logs are added, they must not block
+// nor call storage. Nil hooks are not called.
+type Hooks struct {
+	// PositionOpened is called when the sender of a trade buys a token that it didn't hold
+	PositionOpened func(chain common.Chain, log common.Tradelog)
+	// LogsAdded is called after new trade or transfer logs are added to chain
+	LogsAdded func(chain common.Chain)
+}
+
+// SetHooks sets the hooks that are called from the next added logs.
+func (s *Storage) SetHooks(hooks Hooks) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hooks = hooks
+}
 
-	baseTransferDataByRange := []TransferStorageByRange{
-		NewTransferStorageByRange(time.Hour),
-		NewTransferStorageByRange(time.Hour * 4),
-		NewTransferStorageByRange(time.Hour * 24),      // 1 day
-		NewTransferStorageByRange(time.Hour * 24 * 7),  // 1 week
-		NewTransferStorageByRange(time.Hour * 24 * 30), // 1 month
+func (s *Storage) IsQuote(chain common.Chain, tokenAddress string) bool {
+	return s.quotes.IsQuote(chain, tokenAddress)
+}
+
+// GetQuoteTokens returns the quote tokens of the chain, highest priority first.
+func (s *Storage) GetQuoteTokens(chain common.Chain) []common.QuoteToken {
+	return s.quotes.GetQuotes(chain)
+}
+
+// SetQuoteToken adds or replaces a quote token of the chain, the logs that are already added are not classified again.
+func (s *Storage) SetQuoteToken(chain common.Chain, token common.QuoteToken) error {
+	return s.quotes.Set(chain, token)
+}
+
+// IsSupportedChain returns true if the chain is registered in the storage.
+// Other methods expect a supported chain.
+func (s *Storage) IsSupportedChain(chain common.Chain) bool {
+	_, exist := s.chains[chain]
+	return exist
+}
+
+// Sizes is the number of logs and big transactions in memory of a chain.
+type Sizes struct {
+	TradeLogs    int
+	TransferLogs int
+	BigTxs       int
+}
+
+// GetSizes returns the number of logs and big transactions in memory of chain.
+func (s *Storage) GetSizes(chain common.Chain) Sizes {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data := s.chains[chain]
+	return Sizes{
+		TradeLogs:    len(data.tradeLogs),
+		TransferLogs: len(data.transferLogs),
+		BigTxs:       len(data.bigTx.txs),
 	}
+}
 
-	return &Storage{
-		log: log,
-		chains: map[common.Chain]*ChainData{
-			common.ChainBase: {
-				network:           common.ChainBase,
-				tradeLogs:         make([]common.Tradelog, 0),
-				transferLogs:      make([]common.Transferlog, 0),
-				addrToTokenInfo:   make(map[string]common.Token),
-				tradeDataRange:    baseTradeDataByRange,
-				transferDataRange: baseTransferDataByRange,
-				tokens:            make(map[string]bool),
-				bigTx:             make([]common.BigTx, 0),
-				tokenDeposit:      make(map[string]TokenTransfer),
-				tokenWithdraw:     make(map[string]TokenTransfer),
-			},
-		},
-		tokenUsdtRate: make(map[string]float64),
-		symbolToInfo:  make(map[string]common.CmcTokenInfo),
+func (s *Storage) GetChains() []common.Chain {
+	res := make([]common.Chain, 0, len(s.chains))
+	for chain := range s.chains {
+		res = append(res, chain)
 	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res
 }
 
-func (s *Storage) AddTradeLogs(chain common.Chain, logs []common.Tradelog) {
+// AddLogsResult is the number of logs that are added, skipped as already added,
+// and dropped because their rate couldn't be got.
+type AddLogsResult struct {
+	Added      int
+	Duplicated int
+	Dropped    int
+}
+
+// AddTradeLogs adds the trade logs in block order, the logs that are already added are skipped.
+func (s *Storage) AddTradeLogs(chain common.Chain, logs []common.Tradelog) AddLogsResult {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	var res AddLogsResult
+	if len(logs) == 0 {
+		return res
+	}
+	added := s.chains[chain].tradeKeysFrom(logs[0].BlockNumber)
 	for _, log := range logs {
-		tokenIn := strings.ToLower(log.TokenInAddress)
-		tokenOut := strings.ToLower(log.TokenOutAddress)
-		sender := strings.ToLower(log.Sender)
+		key := logKey(log.TxHash, log.LogIndex)
+		if added[key] {
+			res.Duplicated++
+			continue
+		}
+		added[key] = true
+
+		tokenIn := common.AddressKey(log.TokenInAddress)
+		tokenOut := common.AddressKey(log.TokenOutAddress)
 
 		s.chains[chain].tokens[tokenIn] = true
 		s.chains[chain].tokens[tokenOut] = true
 		if log.GetCurrentRateFail {
+			res.Dropped++
 			continue
 		}
-		// we dont remove old trade, so append it too much can make memory leak
+		res.Added++
+		// old trades are dropped by CompactLogs
 		s.chains[chain].tradeLogs = append(s.chains[chain].tradeLogs, log)
+		s.chains[chain].indexTradeLog(len(s.chains[chain].tradeLogs) - 1)
+		if s.hooks.PositionOpened != nil && !s.quotes.IsQuote(chain, tokenOut) {
+			if p, exist := s.chains[chain].ledger.Positions[common.AddressKey(log.Sender)][tokenOut]; !exist || p.Amount <= dustAmount {
+				s.hooks.PositionOpened(chain, log)
+			}
+		}
+		s.chains[chain].ledger.addTrade(log)
+		s.chains[chain].addTradeCandles(log)
 
 		// add big trade
 		valueInUsdt := log.TokenOutAmount * log.TokenOutUsdtRate
-		if valueInUsdt >= bigVolumeInUsdt {
+		rule, threshold := s.chains[chain].bigTxRule(tokenOut, log.BlockTimestamp)
+		s.chains[chain].addTradeSize(log)
+		if valueInUsdt >= threshold {
 			action := common.SmartMoneyActivitiesBuying
 			// current token to quote token -> selling
-			if util.IsQuote(log.TokenOutAddress) {
+			if s.quotes.IsSelling(chain, tokenIn, tokenOut) {
 				action = common.SmartMoneyActivitiesSelling
 			}
 
-			s.chains[chain].bigTx = append(s.chains[chain].bigTx, common.BigTx{
+			s.addBigTx(chain, common.BigTx{
 				TokenAddress:   log.TokenOutAddress,
 				Time:           log.BlockTimestamp,
 				Sender:         log.Sender,
@@ -185,20 +309,14 @@ func (s *Storage) AddTradeLogs(chain common.Chain, logs []common.Tradelog) {
 				BlockTimestamp: log.BlockTimestamp,
 				BlockNumber:    log.BlockNumber,
 				Tx:             log.TxHash,
+				Rule:           rule,
+				Threshold:      threshold,
 			})
 		}
 
 		// add big data range
 		for i := range s.chains[chain].tradeDataRange {
-			s.chains[chain].tradeDataRange[i].UserProfit[sender] += log.Profit
-			s.chains[chain].tradeDataRange[i].TokenProfit[tokenOut] += log.Profit
-
-			s.chains[chain].tradeDataRange[i].TokenInFlowInUsdt[tokenOut] += log.TokenOutAmount * log.TokenOutUsdtRate
-			s.chains[chain].tradeDataRange[i].TokenInFlow[tokenOut] += log.TokenOutAmount
-
-			s.chains[chain].tradeDataRange[i].TokenOutFlowInUsdt[tokenIn] += log.TokenInAmount * log.TokenInUsdtRate
-			s.chains[chain].tradeDataRange[i].TokenOutFlow[tokenIn] += log.TokenInAmount
-
+			s.chains[chain].tradeDataRange[i].add(log, 1)
 			s.chains[chain].tradeDataRange[i].EndBlockTs = log.BlockTimestamp
 			s.chains[chain].tradeDataRange[i].EndBlock = log.BlockNumber
 
@@ -208,83 +326,191 @@ func (s *Storage) AddTradeLogs(chain common.Chain, logs []common.Tradelog) {
 				s.chains[chain].tradeDataRange[i].StartIndex = len(s.chains[chain].tradeLogs) - 1
 			}
 		}
+		s.chains[chain].tradeMinuteBuckets.get(log.BlockTimestamp).add(log, 1)
+		s.chains[chain].tradeHourBuckets.get(log.BlockTimestamp).add(log, 1)
+	}
+	s.log.Debugw("trade logs", "chain", chain, "len", len(s.chains[chain].tradeLogs), "duplicated", res.Duplicated)
+	if res.Added > 0 && s.hooks.LogsAdded != nil {
+		s.hooks.LogsAdded(chain)
+	}
+	return res
+}
+
+// addBigTx assigns the sequence number of the big transaction, stores it and sends it to the subscribers.
+func (s *Storage) addBigTx(chain common.Chain, tx common.BigTx) {
+	tx.Seq = s.chains[chain].bigTx.nextSeq()
+	s.chains[chain].bigTx.add(tx)
+	s.feed.publish(chain, tx)
+}
+
+func (c *ChainData) indexTradeLog(i int) {
+	log := c.tradeLogs[i]
+	pos := c.tradeLogsOffset + i
+	c.tradeBySender.add(common.AddressKey(log.Sender), pos)
+	c.tradeByToken.add(common.AddressKey(log.TokenInAddress), pos)
+	c.tradeByToken.add(common.AddressKey(log.TokenOutAddress), pos)
+}
+
+// logKey identifies a trade or transfer log.
+func logKey(txHash string, logIndex uint) string {
+	return fmt.Sprintf("%s:%d", strings.ToLower(txHash), logIndex)
+}
+
+// tradeKeysFrom returns the keys of the trade logs from block.
+func (c *ChainData) tradeKeysFrom(block uint64) map[string]bool {
+	i := sort.Search(len(c.tradeLogs), func(i int) bool {
+		return c.tradeLogs[i].BlockNumber >= block
+	})
+	keys := make(map[string]bool, len(c.tradeLogs)-i)
+	for _, log := range c.tradeLogs[i:] {
+		keys[logKey(log.TxHash, log.LogIndex)] = true
 	}
-	s.log.Debugw("trade logs", "chain", chain, "len", len(s.chains[chain].tradeLogs))
+	return keys
+}
+
+// transferKeysFrom returns the keys of the transfer logs from block.
+func (c *ChainData) transferKeysFrom(block uint64) map[string]bool {
+	i := sort.Search(len(c.transferLogs), func(i int) bool {
+		return c.transferLogs[i].BlockNumber >= block
+	})
+	keys := make(map[string]bool, len(c.transferLogs)-i)
+	for _, log := range c.transferLogs[i:] {
+		keys[logKey(log.TxHash, log.LogIndex)] = true
+	}
+	return keys
+}
+
+func (c *ChainData) indexTransferLog(i int) {
+	c.transferByToken.add(common.AddressKey(c.transferLogs[i].TokenAddress), c.transferLogsOffset+i)
+}
+
+// tradeLogsFrom returns the trade logs at positions that are not before from.
+func (c *ChainData) tradeLogsFrom(positions []int, from time.Time) []common.Tradelog {
+	// logs are in block order, skip the old positions
+	i := sort.Search(len(positions), func(i int) bool {
+		return !c.tradeLogs[positions[i]-c.tradeLogsOffset].BlockTimestamp.Before(from)
+	})
+	tradelogs := make([]common.Tradelog, 0, len(positions)-i)
+	for _, pos := range positions[i:] {
+		tradelogs = append(tradelogs, c.revalueTradeLog(c.tradeLogs[pos-c.tradeLogsOffset]))
+	}
+	return tradelogs
+}
+
+// revalueTradeLog sets the current rates and profit of the log from the latest rates,
+// the values of the log at ingest time are kept for the token without rate.
+func (c *ChainData) revalueTradeLog(log common.Tradelog) common.Tradelog {
+	if rate, exist := c.tokenUsdtRate[common.AddressKey(log.TokenInAddress)]; exist {
+		log.CurrentTokenInUsdtRate = rate
+	}
+	if rate, exist := c.tokenUsdtRate[common.AddressKey(log.TokenOutAddress)]; exist {
+		log.CurrentTokenOutUsdtRate = rate
+	}
+	profitOfTokenIn := (log.CurrentTokenInUsdtRate - log.TokenInUsdtRate) * log.TokenInAmount
+	profitOfTokenOut := (log.CurrentTokenOutUsdtRate - log.TokenOutUsdtRate) * log.TokenOutAmount
+	log.Profit = profitOfTokenOut - profitOfTokenIn
+	return log
 }
 
-// heavy action
 func (s *Storage) GetTradeLogsForUser(chain common.Chain, from time.Time, user string) []common.Tradelog {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	tradelogs := []common.Tradelog{}
-	for _, t := range s.chains[chain].tradeLogs {
-		if t.BlockTimestamp.Before(from) {
-			continue
-		}
-		if strings.EqualFold(t.Sender, user) {
-			tradelogs = append(tradelogs, t)
-		}
-	}
-	return tradelogs
+	data := s.chains[chain]
+	return data.tradeLogsFrom(data.tradeBySender[common.AddressKey(user)], from)
 }
 
-// heavy action
 func (s *Storage) GetTradeLogsForToken(chain common.Chain, from time.Time, token string) []common.Tradelog {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	tradelogs := []common.Tradelog{}
-	for _, t := range s.chains[chain].tradeLogs {
-		if t.BlockTimestamp.Before(from) {
-			continue
-		}
-		if strings.EqualFold(t.TokenInAddress, token) || strings.EqualFold(t.TokenOutAddress, token) {
-			tradelogs = append(tradelogs, t)
-		}
-	}
-	return tradelogs
+	data := s.chains[chain]
+	return data.tradeLogsFrom(data.tradeByToken[common.AddressKey(token)], from)
 }
 
 func (s *Storage) GetTradeLogs(chain common.Chain, duration time.Duration) (TradeStorageByRange, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
+	t, err := s.getTradeRange(chain, duration)
+	if err != nil {
+		return TradeStorageByRange{}, err
+	}
+	t.TradeAggregate = t.withProfit(s.chains[chain].tokenUsdtRate)
+	return t, nil
+}
+
+// getTradeRange returns the preset range of duration, or sum the buckets if the duration is not preset.
+func (s *Storage) getTradeRange(chain common.Chain, duration time.Duration) (TradeStorageByRange, error) {
 	for _, t := range s.chains[chain].tradeDataRange {
 		if t.duration == duration {
 			return t, nil
 		}
 	}
-	return TradeStorageByRange{}, fmt.Errorf("invalid duration to get sol trade logs")
+	if duration <= 0 || duration > maxDuration {
+		return TradeStorageByRange{}, fmt.Errorf("invalid duration to get sol trade logs")
+	}
+
+	buckets := s.chains[chain].tradeHourBuckets
+	if duration <= minuteBucketRetention {
+		buckets = s.chains[chain].tradeMinuteBuckets
+	}
+	now := time.Now()
+	res := NewTradeStorageByRange(duration)
+	for _, agg := range buckets.since(now.Add(-duration)) {
+		res.merge(agg)
+	}
+	res.StartBlockTs = now.Add(-duration)
+	res.EndBlockTs = now
+	return res, nil
 }
 
-func (s *Storage) AddTransferLogs(chain common.Chain, logs []common.Transferlog) {
+// AddTransferLogs adds the transfer logs in block order, the logs that are already added are skipped.
+func (s *Storage) AddTransferLogs(chain common.Chain, logs []common.Transferlog) AddLogsResult {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	var res AddLogsResult
+	if len(logs) == 0 {
+		return res
+	}
+	added := s.chains[chain].transferKeysFrom(logs[0].BlockNumber)
 	for _, log := range logs {
-		token := strings.ToLower(log.TokenAddress)
+		key := logKey(log.TxHash, log.LogIndex)
+		if added[key] {
+			res.Duplicated++
+			continue
+		}
+		added[key] = true
+		s.exchanges.Attribute(chain, &log)
+
+		token := common.AddressKey(log.TokenAddress)
 		s.chains[chain].tokens[token] = true
 		if log.GetCurrentRateFail {
+			res.Dropped++
 			continue
 		}
-		// we dont remove old transfer, so append it too much can make memory leak
+		res.Added++
+		// old transfers are dropped by CompactLogs
 		s.chains[chain].transferLogs = append(s.chains[chain].transferLogs, log)
+		s.chains[chain].indexTransferLog(len(s.chains[chain].transferLogs) - 1)
 
 		// add big transfer
 		valueInUsdt := log.TokenAmount * log.CurrentTokenUsdtRate
-		if valueInUsdt >= bigVolumeInUsdt {
-			sender := log.ToAddress
+		rule, threshold := s.chains[chain].bigTxRule(token, log.BlockTimestamp)
+		if valueInUsdt >= threshold {
+			sender, counterparty := log.ToAddress, log.FromAddress
 			if log.IsCexIn {
-				sender = log.FromAddress
+				sender, counterparty = log.FromAddress, log.ToAddress
 			}
 			action := common.SmartMoneyActivitiesDeposit
 			if log.IsCexIn {
 				action = common.SmartMoneyActivitiesWithdraw
 			}
-			s.chains[chain].bigTx = append(s.chains[chain].bigTx, common.BigTx{
+			s.addBigTx(chain, common.BigTx{
 				TokenAddress:   log.TokenAddress,
 				Sender:         sender,
+				Counterparty:   counterparty,
 				Time:           log.BlockTimestamp,
 				ValueInToken:   log.TokenAmount,
 				ValueInUsdt:    valueInUsdt,
@@ -294,18 +520,14 @@ func (s *Storage) AddTransferLogs(chain common.Chain, logs []common.Transferlog)
 				BlockTimestamp: log.BlockTimestamp,
 				BlockNumber:    log.BlockNumber,
 				Tx:             log.TxHash,
+				Rule:           rule,
+				Threshold:      threshold,
 			})
 		}
 
 		// add transfer range data
 		for i := range s.chains[chain].transferDataRange {
-			if log.IsCexIn {
-				s.chains[chain].transferDataRange[i].CexInFlow[token] += log.TokenAmount
-				s.chains[chain].transferDataRange[i].CexInFlowInUsdt[token] += log.TokenAmount * log.CurrentTokenUsdtRate
-			} else {
-				s.chains[chain].transferDataRange[i].CexOutFlow[token] += log.TokenAmount
-				s.chains[chain].transferDataRange[i].CexOutFlowInUsdt[token] += log.TokenAmount * log.CurrentTokenUsdtRate
-			}
+			s.chains[chain].transferDataRange[i].add(log, 1)
 			s.chains[chain].transferDataRange[i].EndBlockTs = log.BlockTimestamp
 			s.chains[chain].transferDataRange[i].EndBlock = log.BlockNumber
 
@@ -315,8 +537,10 @@ func (s *Storage) AddTransferLogs(chain common.Chain, logs []common.Transferlog)
 				s.chains[chain].transferDataRange[i].StartIndex = len(s.chains[chain].transferLogs) - 1
 			}
 		}
+		s.chains[chain].transferMinuteBuckets.get(log.BlockTimestamp).add(log, 1)
+		s.chains[chain].transferHourBuckets.get(log.BlockTimestamp).add(log, 1)
 
-		formatDate := fmt.Sprintf("%d-%d-%d", log.BlockTimestamp.Day(), int(log.BlockTimestamp.Month()), log.BlockTimestamp.Year())
+		formatDate := transferDate(log.BlockTimestamp)
 		if log.IsCexIn {
 			if _, exist := s.chains[chain].tokenDeposit[token]; !exist {
 				s.chains[chain].tokenDeposit[token] = make(TokenTransfer)
@@ -330,18 +554,25 @@ func (s *Storage) AddTransferLogs(chain common.Chain, logs []common.Transferlog)
 		}
 	}
 
-	s.log.Debugw("transfer logs", "chain", chain, "len", len(s.chains[chain].transferLogs))
+	s.log.Debugw("transfer logs", "chain", chain, "len", len(s.chains[chain].transferLogs), "duplicated", res.Duplicated)
+	if res.Added > 0 && s.hooks.LogsAdded != nil {
+		s.hooks.LogsAdded(chain)
+	}
+	return res
 }
 
 func (s *Storage) GetTransferLogsForToken(chain common.Chain, from time.Time, token string) []common.Transferlog {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	transferlogs := []common.Transferlog{}
-	for _, t := range s.chains[chain].transferLogs {
-		if strings.EqualFold(t.TokenAddress, token) {
-			transferlogs = append(transferlogs, t)
-		}
+	data := s.chains[chain]
+	positions := data.transferByToken[common.AddressKey(token)]
+	i := sort.Search(len(positions), func(i int) bool {
+		return !data.transferLogs[positions[i]-data.transferLogsOffset].BlockTimestamp.Before(from)
+	})
+	transferlogs := make([]common.Transferlog, 0, len(positions)-i)
+	for _, pos := range positions[i:] {
+		transferlogs = append(transferlogs, data.transferLogs[pos-data.transferLogsOffset])
 	}
 	return transferlogs
 }
@@ -349,29 +580,58 @@ func (s *Storage) GetTransferLogsForToken(chain common.Chain, from time.Time, to
 func (s *Storage) GetTransferLogs(chain common.Chain, duration time.Duration) (TransferStorageByRange, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
+
+	return s.getTransferRange(chain, duration)
+}
+
+// getTransferRange returns the preset range of duration, or sum the buckets if the duration is not preset.
+func (s *Storage) getTransferRange(chain common.Chain, duration time.Duration) (TransferStorageByRange, error) {
 	for _, t := range s.chains[chain].transferDataRange {
 		if t.duration == duration {
 			return t, nil
 		}
 	}
+	if duration <= 0 || duration > maxDuration {
+		return TransferStorageByRange{}, fmt.Errorf("invalid duration to get transfer logs")
+	}
+
+	buckets := s.chains[chain].transferHourBuckets
+	if duration <= minuteBucketRetention {
+		buckets = s.chains[chain].transferMinuteBuckets
+	}
+	now := time.Now()
+	res := NewTransferStorageByRange(duration)
+	for _, agg := range buckets.since(now.Add(-duration)) {
+		res.merge(agg)
+	}
+	res.StartBlockTs = now.Add(-duration)
+	res.EndBlockTs = now
+	return res, nil
+}
 
-	return TransferStorageByRange{}, fmt.Errorf("invalid duration to get transfer logs")
+// belongToChain returns true if the token from dexscreener is of the chain
+func belongToChain(t common.Token, chain common.Chain) bool {
+	return t.ChainID == chain.String()
 }
 
-// we lowercase all key
-func (s *Storage) SetTokenUsdtRate(rates []common.Token) {
+// SetTokenUsdtRate keys the rates by common.AddressKey of the token
+func (s *Storage) SetTokenUsdtRate(chain common.Chain, rates []common.Token) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	for _, rate := range rates {
-		s.tokenUsdtRate[strings.ToLower(rate.Address)] = rate.UsdPrice
+		// rate without chain id is from the rate source of this chain
+		if rate.ChainID != "" && !belongToChain(rate, chain) {
+			continue
+		}
+		s.chains[chain].tokenUsdtRate[common.AddressKey(rate.Address)] = rate.UsdPrice
 	}
 }
 
-func (s *Storage) GetTokenUsdtRate() map[string]float64 {
+func (s *Storage) GetTokenUsdtRate(chain common.Chain) map[string]float64 {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 	tokenUsdtRate := map[string]float64{}
-	for k, v := range s.tokenUsdtRate {
+	for k, v := range s.chains[chain].tokenUsdtRate {
 		tokenUsdtRate[k] = v
 	}
 
@@ -379,12 +639,12 @@ func (s *Storage) GetTokenUsdtRate() map[string]float64 {
 }
 
 // set token info from dexscreener
-func (s *Storage) SetAddrToTokenInfo(tokens []common.Token) {
+func (s *Storage) SetAddrToTokenInfo(chain common.Chain, tokens []common.Token) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	for _, t := range tokens {
-		if t.ChainID == common.ChainBase.String() {
-			s.chains[common.ChainBase].addrToTokenInfo[strings.ToLower(t.Address)] = t
+		if belongToChain(t, chain) {
+			s.chains[chain].addrToTokenInfo[common.AddressKey(t.Address)] = t
 		}
 	}
 }
@@ -401,6 +661,13 @@ func (s *Storage) GetTokenInfo(chain common.Chain) map[string]common.Token {
 	return tokens
 }
 
+// GetTokenInfoByAddress returns the token info from dexscreener of a token
+func (s *Storage) GetTokenInfoByAddress(chain common.Chain, address string) common.Token {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.chains[chain].addrToTokenInfo[common.AddressKey(address)]
+}
+
 // set token info from dexscreener
 func (s *Storage) SetSymbolToTokenInfoFromCmc(tokens common.CmcTokens) {
 	s.mutex.Lock()
@@ -436,20 +703,8 @@ func (s *Storage) RemoveTrades(sugar *zap.SugaredLogger, chain common.Chain) {
 				time.Since(s.chains[chain].tradeLogs[currentIndex].BlockTimestamp) <= duration {
 				break
 			}
-			log := s.chains[chain].tradeLogs[currentIndex]
-			tokenIn := strings.ToLower(log.TokenInAddress)
-			tokenOut := strings.ToLower(log.TokenOutAddress)
-			sender := strings.ToLower(log.Sender)
-
 			// old trade, remove it
-			s.chains[chain].tradeDataRange[i].UserProfit[sender] -= log.Profit
-			s.chains[chain].tradeDataRange[i].TokenProfit[tokenOut] -= log.Profit
-
-			s.chains[chain].tradeDataRange[i].TokenInFlowInUsdt[tokenOut] -= log.TokenOutAmount * log.TokenOutUsdtRate
-			s.chains[chain].tradeDataRange[i].TokenInFlow[tokenOut] -= log.TokenOutAmount
-
-			s.chains[chain].tradeDataRange[i].TokenOutFlowInUsdt[tokenIn] -= log.TokenInAmount * log.TokenInUsdtRate
-			s.chains[chain].tradeDataRange[i].TokenOutFlow[tokenIn] -= log.TokenInAmount
+			s.chains[chain].tradeDataRange[i].add(s.chains[chain].tradeLogs[currentIndex], -1)
 			currentIndex++
 		}
 		if currentIndex > s.chains[chain].tradeDataRange[i].StartIndex {
@@ -465,6 +720,13 @@ func (s *Storage) RemoveTrades(sugar *zap.SugaredLogger, chain common.Chain) {
 			}
 		}
 	}
+
+	now := time.Now()
+	s.chains[chain].tradeMinuteBuckets.prune(now)
+	s.chains[chain].tradeHourBuckets.prune(now)
+	s.chains[chain].pruneCandles(now)
+	s.chains[chain].pruneTokenSizes(now)
+	s.chains[chain].bigTx.prune(now)
 }
 
 func (s *Storage) RemoveTransfer(sugar *zap.SugaredLogger, chain common.Chain) {
@@ -483,17 +745,7 @@ func (s *Storage) RemoveTransfer(sugar *zap.SugaredLogger, chain common.Chain) {
 				time.Since(s.chains[chain].transferLogs[currentIndex].BlockTimestamp) <= duration {
 				break
 			}
-			log := s.chains[chain].transferLogs[currentIndex]
-			token := strings.ToLower(log.TokenAddress)
-
-			if log.IsCexIn {
-				s.chains[chain].transferDataRange[i].CexInFlow[token] -= log.TokenAmount
-				s.chains[chain].transferDataRange[i].CexInFlowInUsdt[token] -= log.TokenAmount * log.CurrentTokenUsdtRate
-			} else {
-				s.chains[chain].transferDataRange[i].CexOutFlow[token] -= log.TokenAmount
-				s.chains[chain].transferDataRange[i].CexOutFlowInUsdt[token] -= log.TokenAmount * log.CurrentTokenUsdtRate
-			}
-
+			s.chains[chain].transferDataRange[i].add(s.chains[chain].transferLogs[currentIndex], -1)
 			currentIndex++
 		}
 		if currentIndex > s.chains[chain].transferDataRange[i].StartIndex {
@@ -510,6 +762,82 @@ func (s *Storage) RemoveTransfer(sugar *zap.SugaredLogger, chain common.Chain) {
 			}
 		}
 	}
+
+	now := time.Now()
+	s.chains[chain].transferMinuteBuckets.prune(now)
+	s.chains[chain].transferHourBuckets.prune(now)
+}
+
+// CompactResult reports what a compaction pass dropped from a chain.
+type CompactResult struct {
+	TradeLogsRemoved    int
+	TransferLogsRemoved int
+	// closed positions of the ledger that are older than the retention
+	PositionsRemoved int
+	// approximate, only counts the struct size of the dropped entries
+	ReclaimedBytes uint64
+}
+
+// CompactLogs physically drops the trade and transfer logs that are already out of the longest range
+// and rebases the StartIndex of every range, and drops the old closed positions of the ledger.
+// It should be called after RemoveTrades and RemoveTransfer.
+func (s *Storage) CompactLogs(chain common.Chain) CompactResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var res CompactResult
+	data := s.chains[chain]
+
+	// the longest range always has the smallest start index
+	tradeStart := len(data.tradeLogs)
+	for _, r := range data.tradeDataRange {
+		if r.StartIndex != -1 && r.StartIndex < tradeStart {
+			tradeStart = r.StartIndex
+		}
+	}
+	if tradeStart > 0 {
+		oldCap := cap(data.tradeLogs)
+		// copy to a new slice, re-slicing keeps the old backing array alive
+		tradeLogs := make([]common.Tradelog, len(data.tradeLogs)-tradeStart)
+		copy(tradeLogs, data.tradeLogs[tradeStart:])
+		data.tradeLogs = tradeLogs
+		for i := range data.tradeDataRange {
+			if data.tradeDataRange[i].StartIndex != -1 {
+				data.tradeDataRange[i].StartIndex -= tradeStart
+			}
+		}
+		data.tradeLogsOffset += tradeStart
+		data.tradeBySender.prune(data.tradeLogsOffset)
+		data.tradeByToken.prune(data.tradeLogsOffset)
+		res.TradeLogsRemoved = tradeStart
+		res.ReclaimedBytes += uint64(oldCap-cap(tradeLogs)) * uint64(unsafe.Sizeof(common.Tradelog{}))
+	}
+
+	transferStart := len(data.transferLogs)
+	for _, r := range data.transferDataRange {
+		if r.StartIndex != -1 && r.StartIndex < transferStart {
+			transferStart = r.StartIndex
+		}
+	}
+	if transferStart > 0 {
+		oldCap := cap(data.transferLogs)
+		transferLogs := make([]common.Transferlog, len(data.transferLogs)-transferStart)
+		copy(transferLogs, data.transferLogs[transferStart:])
+		data.transferLogs = transferLogs
+		for i := range data.transferDataRange {
+			if data.transferDataRange[i].StartIndex != -1 {
+				data.transferDataRange[i].StartIndex -= transferStart
+			}
+		}
+		data.transferLogsOffset += transferStart
+		data.transferByToken.prune(data.transferLogsOffset)
+		res.TransferLogsRemoved = transferStart
+		res.ReclaimedBytes += uint64(oldCap-cap(transferLogs)) * uint64(unsafe.Sizeof(common.Transferlog{}))
+	}
+
+	res.PositionsRemoved = data.ledger.prune(time.Now().Add(-positionRetention))
+	res.ReclaimedBytes += uint64(res.PositionsRemoved) * uint64(unsafe.Sizeof(Position{}))
+	return res
 }
 
 func (s *Storage) GetTokens(chain common.Chain) []string {
@@ -523,58 +851,50 @@ func (s *Storage) GetTokens(chain common.Chain) []string {
 	return res
 }
 
-func (s *Storage) GetLastBigTx(chain common.Chain, action common.SmartMoneyActivities, last int) []common.BigTx {
+// GetLastBigTx returns up to last latest big transactions of action before the cursor and the number of them.
+func (s *Storage) GetLastBigTx(chain common.Chain, action common.SmartMoneyActivities, last int, before BigTxCursor) ([]common.BigTx, int) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	res := []common.BigTx{}
-	for i := len(s.chains[chain].bigTx) - 1; i >= 0; i-- {
-		if action == common.SmartMoneyActivitiesAll || action == s.chains[chain].bigTx[i].Action {
-			res = append(res, s.chains[chain].bigTx[i])
-		}
-	}
-	sort.Slice(res, func(i, j int) bool {
-		return res[i].BlockNumber > res[j].BlockNumber
-	})
-	return res
+	return s.chains[chain].bigTx.last(action, last, before)
 }
 
-func (s *Storage) GetLastBigTxForToken(chain common.Chain, action common.SmartMoneyActivities, last int, tokenAddress string) []common.BigTx {
+// GetLastBigTxForToken returns up to last latest big transactions of action of the token before the cursor and the number of them.
+func (s *Storage) GetLastBigTxForToken(chain common.Chain, action common.SmartMoneyActivities, last int, before BigTxCursor, tokenAddress string) ([]common.BigTx, int) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	res := []common.BigTx{}
-	for i := len(s.chains[chain].bigTx) - 1; i >= 0; i-- {
-		if !strings.EqualFold(s.chains[chain].bigTx[i].TokenAddress, tokenAddress) {
-			continue
-		}
-		if action == common.SmartMoneyActivitiesAll || action == s.chains[chain].bigTx[i].Action {
-			res = append(res, s.chains[chain].bigTx[i])
-		}
-	}
-	sort.Slice(res, func(i, j int) bool {
-		return res[i].BlockNumber > res[j].BlockNumber
-	})
-	return res
+	txs := s.chains[chain].bigTx.byToken[common.AddressKey(tokenAddress)]
+	return txs.last(action, last, before), txs.count(action)
 }
 
-func (s *Storage) GetLastBigTxForUser(chain common.Chain, action common.SmartMoneyActivities, last int, userAddress string) []common.BigTx {
+// GetLastBigTxForUser returns up to last latest big transactions of action of the user before the cursor and the number of them.
+func (s *Storage) GetLastBigTxForUser(chain common.Chain, action common.SmartMoneyActivities, last int, before BigTxCursor, userAddress string) ([]common.BigTx, int) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	res := []common.BigTx{}
-	for i := len(s.chains[chain].bigTx) - 1; i >= 0; i-- {
-		if !strings.EqualFold(s.chains[chain].bigTx[i].Sender, userAddress) {
-			continue
-		}
-		if action == common.SmartMoneyActivitiesAll || action == s.chains[chain].bigTx[i].Action {
-			res = append(res, s.chains[chain].bigTx[i])
-		}
-	}
-	sort.Slice(res, func(i, j int) bool {
-		return res[i].BlockNumber > res[j].BlockNumber
-	})
-	return res
+	txs := s.chains[chain].bigTx.bySender[common.AddressKey(userAddress)]
+	return txs.last(action, last, before), txs.count(action)
+}
+
+// GetLastBigTxForTokens returns up to last latest big transactions of action of any of the tokens before the cursor
+// and the number of them.
+func (s *Storage) GetLastBigTxForTokens(chain common.Chain, action common.SmartMoneyActivities, last int, before BigTxCursor, tokenAddresses []string) ([]common.BigTx, int) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	b := s.chains[chain].bigTx
+	return b.lastOf(b.byToken, tokenAddresses, action, last, before)
+}
+
+// GetLastBigTxForUsers returns up to last latest big transactions of action of any of the users before the cursor
+// and the number of them.
+func (s *Storage) GetLastBigTxForUsers(chain common.Chain, action common.SmartMoneyActivities, last int, before BigTxCursor, userAddresses []string) ([]common.BigTx, int) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	b := s.chains[chain].bigTx
+	return b.lastOf(b.bySender, userAddresses, action, last, before)
 }
 
 func (s *Storage) SetTrendingToken(t coingecko.CoingeckoTrending) {
@@ -593,57 +913,66 @@ func (s *Storage) GetTokenInFlowInUsdt(chain common.Chain, duration time.Duratio
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for _, t := range s.chains[chain].tradeDataRange {
-		if t.duration == duration {
-			return t.TokenInFlowInUsdt, nil
-		}
+	t, err := s.getTradeRange(chain, duration)
+	if err != nil {
+		return map[string]float64{}, err
 	}
-
-	return map[string]float64{}, fmt.Errorf("invalid duration to get trade logs")
+	return t.TokenInFlowInUsdt, nil
 }
 
 func (s *Storage) GetTokenInFlow(chain common.Chain, duration time.Duration) (map[string]float64, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for _, t := range s.chains[chain].tradeDataRange {
-		if t.duration == duration {
-			return t.TokenInFlow, nil
-		}
+	t, err := s.getTradeRange(chain, duration)
+	if err != nil {
+		return map[string]float64{}, err
 	}
-
-	return map[string]float64{}, fmt.Errorf("invalid duration to get trade logs")
+	return t.TokenInFlow, nil
 }
 
 func (s *Storage) GetTokenOutFlowInUsdt(chain common.Chain, duration time.Duration) (map[string]float64, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for _, t := range s.chains[chain].tradeDataRange {
-		if t.duration == duration {
-			return t.TokenOutFlowInUsdt, nil
-		}
+	t, err := s.getTradeRange(chain, duration)
+	if err != nil {
+		return map[string]float64{}, err
 	}
-
-	return map[string]float64{}, fmt.Errorf("invalid duration to get sol transfer logs")
+	return t.TokenOutFlowInUsdt, nil
 }
 
 func (s *Storage) GetTokenOutFlow(chain common.Chain, duration time.Duration) (map[string]float64, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for _, t := range s.chains[chain].tradeDataRange {
-		if t.duration == duration {
-			return t.TokenOutFlow, nil
-		}
+	t, err := s.getTradeRange(chain, duration)
+	if err != nil {
+		return map[string]float64{}, err
 	}
+	return t.TokenOutFlow, nil
+}
 
-	return map[string]float64{}, fmt.Errorf("invalid duration to get sol transfer logs")
+// transferDate is the key of TokenTransfer
+func transferDate(t time.Time) string {
+	return fmt.Sprintf("%d-%d-%d", t.Day(), int(t.Month()), t.Year())
 }
 
-func (s *Storage) GetPriceWithTransferByRange(chain common.Chain, token string) (TokenTransfer, TokenTransfer) {
+// GetPriceWithTransferByRange returns the deposit, withdraw and the close price of the token by date.
+func (s *Storage) GetPriceWithTransferByRange(chain common.Chain, token string) (TokenTransfer, TokenTransfer, TokenTransfer) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	return s.chains[chain].tokenDeposit[token], s.chains[chain].tokenWithdraw[token]
+	price := make(TokenTransfer)
+	if candles, exist := s.chains[chain].candles[token]; exist {
+		for i, c := range candleIntervals {
+			if c.interval != CandleInterval1d {
+				continue
+			}
+			for _, candle := range candles.Candles[i] {
+				price[transferDate(candle.Start)] = candle.Close
+			}
+		}
+	}
+	return s.chains[chain].tokenDeposit[token], s.chains[chain].tokenWithdraw[token], price
 }
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+const (
+	BigTxRuleToken      = "token"
+	BigTxRulePercentile = "percentile"
+	BigTxRuleChain      = "chain"
+)
+
+const (
+	// DefaultBigTxMinUsd is the minimum usd value of a big transaction if the chain is not configured
+	DefaultBigTxMinUsd = 50_000
+
+	percentileWindow = time.Hour * 24
+	// the percentile rule is skipped for the token with less trades in the window
+	percentileMinSamples = 100
+	// the percentile of a token is computed at most once per percentileRefresh
+	percentileRefresh = time.Minute
+)
+
+type sizeSample struct {
+	ts    time.Time
+	value float64
+}
+
+// tokenSizes is the usd value of the trades of a token in the percentile window.
+type tokenSizes struct {
+	samples    []sizeSample
+	percentile float64
+	threshold  float64
+	computedAt time.Time
+}
+
+func (t *tokenSizes) add(ts time.Time, value float64) {
+	t.samples = append(t.samples, sizeSample{ts: ts, value: value})
+}
+
+// get returns the value at percentile p of the samples in the window before now,
+// false if there are not enough samples.
+func (t *tokenSizes) get(now time.Time, p float64) (float64, bool) {
+	if p == t.percentile && !now.Before(t.computedAt) && now.Sub(t.computedAt) < percentileRefresh {
+		return t.threshold, t.threshold > 0
+	}
+
+	from := now.Add(-percentileWindow)
+	i := 0
+	for i < len(t.samples) && t.samples[i].ts.Before(from) {
+		i++
+	}
+	if i > 0 {
+		t.samples = append(make([]sizeSample, 0, len(t.samples)-i), t.samples[i:]...)
+	}
+
+	t.percentile = p
+	t.computedAt = now
+	t.threshold = 0
+	if len(t.samples) < percentileMinSamples {
+		return 0, false
+	}
+	values := make([]float64, len(t.samples))
+	for i, s := range t.samples {
+		values[i] = s.value
+	}
+	sort.Float64s(values)
+	idx := int(float64(len(values)-1) * p / 100)
+	t.threshold = values[idx]
+	return t.threshold, t.threshold > 0
+}
+
+func (c *ChainData) addTradeSize(log common.Tradelog) {
+	token := common.AddressKey(log.TokenOutAddress)
+	sizes, exist := c.tokenSizes[token]
+	if !exist {
+		sizes = &tokenSizes{}
+		c.tokenSizes[token] = sizes
+	}
+	sizes.add(log.BlockTimestamp, log.TokenOutAmount*log.TokenOutUsdtRate)
+}
+
+// bigTxRule returns the rule of the token at ts and its threshold.
+func (c *ChainData) bigTxRule(token string, ts time.Time) (string, float64) {
+	token = common.AddressKey(token)
+	if threshold, exist := c.bigTxThreshold.Tokens[token]; exist {
+		return BigTxRuleToken, threshold
+	}
+	if c.bigTxThreshold.Percentile > 0 {
+		if sizes, exist := c.tokenSizes[token]; exist {
+			if threshold, ok := sizes.get(ts, c.bigTxThreshold.Percentile); ok {
+				if threshold < c.bigTxThreshold.PercentileMinUsd {
+					threshold = c.bigTxThreshold.PercentileMinUsd
+				}
+				return BigTxRulePercentile, threshold
+			}
+		}
+	}
+	return BigTxRuleChain, c.bigTxThreshold.MinUsd
+}
+
+func (c *ChainData) pruneTokenSizes(now time.Time) {
+	from := now.Add(-percentileWindow)
+	for token, sizes := range c.tokenSizes {
+		if n := len(sizes.samples); n == 0 || sizes.samples[n-1].ts.Before(from) {
+			delete(c.tokenSizes, token)
+		}
+	}
+}
+
+func validateBigTxThreshold(t common.BigTxThreshold) error {
+	if t.MinUsd <= 0 {
+		return fmt.Errorf("min usd must be positive")
+	}
+	if t.Percentile < 0 || t.Percentile >= 100 {
+		return fmt.Errorf("percentile must be in [0, 100)")
+	}
+	if t.PercentileMinUsd < 0 {
+		return fmt.Errorf("percentile min usd must not be negative")
+	}
+	for token, v := range t.Tokens {
+		if v <= 0 {
+			return fmt.Errorf("min usd of token %s must be positive", token)
+		}
+	}
+	return nil
+}
+
+// SetBigTxThreshold replaces the big transaction rules of chain, it only applies to the new logs.
+func (s *Storage) SetBigTxThreshold(chain common.Chain, t common.BigTxThreshold) error {
+	if err := validateBigTxThreshold(t); err != nil {
+		return err
+	}
+	tokens := make(map[string]float64, len(t.Tokens))
+	for token, v := range t.Tokens {
+		tokens[common.AddressKey(token)] = v
+	}
+	t.Tokens = tokens
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.chains[chain].bigTxThreshold = t
+	return nil
+}
+
+func (s *Storage) GetBigTxThreshold(chain common.Chain) common.BigTxThreshold {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	t := s.chains[chain].bigTxThreshold
+	tokens := make(map[string]float64, len(t.Tokens))
+	for token, v := range t.Tokens {
+		tokens[token] = v
+	}
+	t.Tokens = tokens
+	return t
+}
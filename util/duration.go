@@ -0,0 +1,28 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses duration like time.ParseDuration, it also accepts
+// day and week units as a single suffix, e.g. 3d or 2w.
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": time.Hour * 24,
+		"w": time.Hour * 24 * 7,
+	}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	return time.ParseDuration(s)
+}
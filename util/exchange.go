@@ -0,0 +1,60 @@
+package util
+
+import (
+	"sync"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// ExchangeRegistry maps the cex wallets of each chain to their exchange, see common.AddressKey for the lookup.
+type ExchangeRegistry struct {
+	mutex   sync.RWMutex
+	wallets map[common.Chain]map[string]string
+}
+
+func NewExchangeRegistry() *ExchangeRegistry {
+	return &ExchangeRegistry{
+		wallets: make(map[common.Chain]map[string]string),
+	}
+}
+
+// Add adds or replaces the wallets of the exchange on the chain.
+func (r *ExchangeRegistry) Add(chain common.Chain, exchange string, addresses ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exist := r.wallets[chain]; !exist {
+		r.wallets[chain] = make(map[string]string)
+	}
+	for _, addr := range addresses {
+		r.wallets[chain][common.AddressKey(addr)] = exchange
+	}
+}
+
+// Exchange returns the exchange of the wallet.
+func (r *ExchangeRegistry) Exchange(chain common.Chain, address string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	exchange, exist := r.wallets[chain][common.AddressKey(address)]
+	return exchange, exist
+}
+
+// Attribute sets the exchange of the transfer and derives IsCexIn from the registered wallets,
+// a transfer to a cex wallet is cex in. A transfer between two cex wallets is cex in of the destination
+// and keeps the source in FromExchange. The upstream IsCexIn is kept if no wallet is registered.
+func (r *ExchangeRegistry) Attribute(chain common.Chain, log *common.Transferlog) {
+	to, toExist := r.Exchange(chain, log.ToAddress)
+	from, fromExist := r.Exchange(chain, log.FromAddress)
+	switch {
+	case toExist:
+		log.Exchange = to
+		log.IsCexIn = true
+		if fromExist {
+			log.FromExchange = from
+		}
+	case fromExist:
+		log.Exchange = from
+		log.IsCexIn = false
+	}
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+// LabelRegistry keeps the labels of each chain, a label is found by any case of an evm address
+// but only by the exact solana address.
+type LabelRegistry struct {
+	mutex  sync.RWMutex
+	labels map[common.Chain]map[string]common.WalletLabel
+}
+
+func NewLabelRegistry() *LabelRegistry {
+	return &LabelRegistry{
+		labels: make(map[common.Chain]map[string]common.WalletLabel),
+	}
+}
+
+// LoadFile adds the labels of a json file, an array of labels, or a csv file with the columns
+// chain, address, name, category and an optional header.
+func (r *LabelRegistry) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var labels []common.WalletLabel
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&labels); err != nil {
+			return fmt.Errorf("parse labels %s: %w", path, err)
+		}
+	case ".csv":
+		if labels, err = readLabelsCsv(f); err != nil {
+			return fmt.Errorf("parse labels %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("labels %s: unknown format, expected .json or .csv", path)
+	}
+
+	for _, l := range labels {
+		if err := r.Set(l); err != nil {
+			return fmt.Errorf("labels %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func readLabelsCsv(reader io.Reader) ([]common.WalletLabel, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && strings.EqualFold(records[0][0], "chain") {
+		records = records[1:]
+	}
+	labels := make([]common.WalletLabel, 0, len(records))
+	for i, record := range records {
+		if len(record) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 columns, got %d", i+1, len(record))
+		}
+		chain, err := common.ChainString(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		category, err := common.LabelCategoryString(strings.TrimSpace(record[3]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		labels = append(labels, common.WalletLabel{
+			Chain:    chain,
+			Address:  strings.TrimSpace(record[1]),
+			Name:     strings.TrimSpace(record[2]),
+			Category: category,
+		})
+	}
+	return labels, nil
+}
+
+// Set adds or replaces the label of an address.
+func (r *LabelRegistry) Set(label common.WalletLabel) error {
+	if !label.Chain.IsAChain() {
+		return fmt.Errorf("invalid chain of label %s", label.Address)
+	}
+	if label.Address == "" || label.Name == "" {
+		return errors.New("label needs an address and a name")
+	}
+	if !label.Category.IsALabelCategory() {
+		return fmt.Errorf("invalid category of label %s", label.Address)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exist := r.labels[label.Chain]; !exist {
+		r.labels[label.Chain] = make(map[string]common.WalletLabel)
+	}
+	label.Address = common.AddressKey(label.Address)
+	r.labels[label.Chain][label.Address] = label
+	return nil
+}
+
+// Remove removes the label of an address, it returns false if the address has no label.
+func (r *LabelRegistry) Remove(chain common.Chain, address string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	address = common.AddressKey(address)
+	if _, exist := r.labels[chain][address]; !exist {
+		return false
+	}
+	delete(r.labels[chain], address)
+	return true
+}
+
+// Get returns the label of an address.
+func (r *LabelRegistry) Get(chain common.Chain, address string) (common.WalletLabel, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	l, exist := r.labels[chain][common.AddressKey(address)]
+	return l, exist
+}
+
+// GetLabels returns the labels of the chain by address.
+func (r *LabelRegistry) GetLabels(chain common.Chain) []common.WalletLabel {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]common.WalletLabel, 0, len(r.labels[chain]))
+	for _, l := range r.labels[chain] {
+		res = append(res, l)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Address < res[j].Address
+	})
+	return res
+}
@@ -0,0 +1,144 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kv-base-hack/base-server-api/common"
+)
+
+const (
+	nativePriority = 10
+	wrapPriority   = 20
+	stablePriority = 30
+)
+
+// defaultQuotes are the quote tokens of each chain, they can be overridden by chain config.
+var defaultQuotes = map[common.Chain][]common.QuoteToken{
+	common.ChainBase: {
+		{Address: "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", Symbol: "ETH", Priority: nativePriority},
+		{Address: "0x4200000000000000000000000000000000000006", Symbol: "WETH", Priority: wrapPriority},
+		{Address: "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913", Symbol: "USDC", Priority: stablePriority},
+		{Address: "0xd9aAEc86B65D86f6A7B5B1b0c42FFA531710b6CA", Symbol: "USDbC", Priority: stablePriority},
+		{Address: "0x50c5725949A6F0c72E6C4a641F24049A917DB0Cb", Symbol: "DAI", Priority: stablePriority},
+	},
+	common.ChainEthereum: {
+		{Address: "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", Symbol: "ETH", Priority: nativePriority},
+		{Address: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", Symbol: "WETH", Priority: wrapPriority},
+		{Address: "0xdac17f958d2ee523a2206206994597c13d831ec7", Symbol: "USDT", Priority: stablePriority},
+		{Address: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Symbol: "USDC", Priority: stablePriority},
+		{Address: "0x6b175474e89094c44da98b954eedeac495271d0f", Symbol: "DAI", Priority: stablePriority},
+		{Address: "0x853d955acef822db058eb8505911ed77f175b99e", Symbol: "FRAX", Priority: stablePriority},
+	},
+	common.ChainArbitrum: {
+		{Address: "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", Symbol: "ETH", Priority: nativePriority},
+		{Address: "0x82aF49447D8a07e3bd95BD0d56f35241523fBab1", Symbol: "WETH", Priority: wrapPriority},
+		{Address: "0xaf88d065e77c8cC2239327C5EDb3A432268e5831", Symbol: "USDC", Priority: stablePriority},
+		{Address: "0xFF970A61A04b1cA14834A43f5dE4533eBDDB5CC8", Symbol: "USDC.e", Priority: stablePriority},
+		{Address: "0xFd086bC7CD5C481DCC9C85ebE478A1C0b69FCbb9", Symbol: "USDT", Priority: stablePriority},
+	},
+	common.ChainOptimism: {
+		{Address: "0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", Symbol: "ETH", Priority: nativePriority},
+		{Address: "0x4200000000000000000000000000000000000006", Symbol: "WETH", Priority: wrapPriority},
+		{Address: "0x0b2C639c533813f4Aa9D7837CAf62653d097Ff85", Symbol: "USDC", Priority: stablePriority},
+		{Address: "0x7F5c764cBc14f9669B88837ca1490cCa17c31607", Symbol: "USDC.e", Priority: stablePriority},
+		{Address: "0x94b008aA00579c1307B0EF2c499aD98a8ce58e58", Symbol: "USDT", Priority: stablePriority},
+	},
+	common.ChainSolana: {
+		{Address: "So11111111111111111111111111111111111111112", Symbol: "SOL", Priority: wrapPriority},
+		{Address: "EPjFWdd5AufqSSqeM2qN1xxybapC8G4wEGGkZwyTDt1v", Symbol: "USDC", Priority: stablePriority},
+		{Address: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", Symbol: "USDT", Priority: stablePriority},
+	},
+}
+
+// QuoteRegistry keeps the quote tokens of each chain by address key, the tokens keep their address as configured.
+type QuoteRegistry struct {
+	mutex  sync.RWMutex
+	quotes map[common.Chain]map[string]common.QuoteToken
+}
+
+// NewQuoteRegistry returns a registry with the default quote tokens of all chains.
+func NewQuoteRegistry() *QuoteRegistry {
+	r := &QuoteRegistry{
+		quotes: make(map[common.Chain]map[string]common.QuoteToken),
+	}
+	for chain, tokens := range defaultQuotes {
+		r.Add(chain, tokens...)
+	}
+	return r
+}
+
+// Add adds or replaces quote tokens of the chain.
+func (r *QuoteRegistry) Add(chain common.Chain, tokens ...common.QuoteToken) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exist := r.quotes[chain]; !exist {
+		r.quotes[chain] = make(map[string]common.QuoteToken)
+	}
+	for _, t := range tokens {
+		r.quotes[chain][common.AddressKey(t.Address)] = t
+	}
+}
+
+// Set checks and adds or replaces a quote token of the chain.
+func (r *QuoteRegistry) Set(chain common.Chain, token common.QuoteToken) error {
+	if !chain.IsAChain() {
+		return fmt.Errorf("invalid chain of quote token %s", token.Address)
+	}
+	if token.Address == "" || token.Symbol == "" {
+		return errors.New("quote token needs an address and a symbol")
+	}
+	if token.Priority <= 0 {
+		return fmt.Errorf("priority of quote token %s must be positive", token.Address)
+	}
+	r.Add(chain, token)
+	return nil
+}
+
+// Priority returns the priority of the token, 0 if it is not a quote token.
+func (r *QuoteRegistry) Priority(chain common.Chain, tokenAddress string) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	t, exist := r.quotes[chain][common.AddressKey(tokenAddress)]
+	if !exist {
+		return 0
+	}
+	return t.Priority
+}
+
+func (r *QuoteRegistry) IsQuote(chain common.Chain, tokenAddress string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, exist := r.quotes[chain][common.AddressKey(tokenAddress)]
+	return exist
+}
+
+// IsSelling returns true if the swap from tokenIn to tokenOut is selling tokenIn,
+// it means tokenOut is more likely to be the quote token than tokenIn.
+// e.g. WETH -> USDC is selling WETH and USDC -> WETH is buying WETH.
+func (r *QuoteRegistry) IsSelling(chain common.Chain, tokenIn, tokenOut string) bool {
+	return r.Priority(chain, tokenOut) > r.Priority(chain, tokenIn)
+}
+
+// GetQuotes returns quote tokens of the chain, highest priority first.
+func (r *QuoteRegistry) GetQuotes(chain common.Chain) []common.QuoteToken {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]common.QuoteToken, 0, len(r.quotes[chain]))
+	for _, t := range r.quotes[chain] {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Priority != res[j].Priority {
+			return res[i].Priority > res[j].Priority
+		}
+		return common.AddressKey(res[i].Address) < common.AddressKey(res[j].Address)
+	})
+	return res
+}
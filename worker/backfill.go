@@ -0,0 +1,235 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/storage"
+	"github.com/kv-base-hack/base-server-api/storage/db"
+	"go.uber.org/zap"
+)
+
+// backfillCheckpointDuration is how often the progress of a backfill is saved
+const backfillCheckpointDuration = time.Minute
+
+// BackfillProgress is saved next to the output, so a backfill of the same range resumes from the checkpoint.
+type BackfillProgress struct {
+	Chain             common.Chain `json:"chain"`
+	FromBlock         int64        `json:"from_block"`
+	ToBlock           int64        `json:"to_block"`
+	LastTradeBlock    int64        `json:"last_trade_block"`
+	LastTransferBlock int64        `json:"last_transfer_block"`
+	// logs without rate, they are not in the snapshot
+	DroppedTrades    int `json:"dropped_trades"`
+	DroppedTransfers int `json:"dropped_transfers"`
+}
+
+// Backfill replays the trades and transfers of a block range from database into storage
+// with the same conversion as SolanaLogs, the result is written as a snapshot.
+type Backfill struct {
+	log            *zap.SugaredLogger
+	chain          common.Chain
+	tradeTable     string
+	transferTable  string
+	db             db.DB
+	storage        *storage.Storage
+	output         string
+	progressPath   string
+	checkpointPath string
+	lastCheckpoint time.Time
+}
+
+// NewBackfill creates a backfill of a chain into the snapshot at output, the progress is saved
+// to output.progress and output.partial.
+func NewBackfill(log *zap.SugaredLogger, db db.DB, storage *storage.Storage, config common.ChainConfig, output string) *Backfill {
+	return &Backfill{
+		log:            log.With("worker", "backfill", "chain", config.Chain),
+		chain:          config.Chain,
+		tradeTable:     config.TradeTable,
+		transferTable:  config.TransferTable,
+		db:             db,
+		storage:        storage,
+		output:         output,
+		progressPath:   output + ".progress",
+		checkpointPath: output + ".partial",
+	}
+}
+
+// BlockRange returns the blocks of the trades in [from, to].
+func (b *Backfill) BlockRange(from, to time.Time) (int64, int64, error) {
+	fromBlock, toBlock, err := b.db.GetBlockRange(b.tradeTable, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fromBlock == 0 && toBlock == 0 {
+		return 0, 0, fmt.Errorf("no trade in [%s, %s]", from, to)
+	}
+	return fromBlock, toBlock, nil
+}
+
+// Run replays the blocks [fromBlock, toBlock] and writes the snapshot, it resumes from the saved progress of the same range.
+func (b *Backfill) Run(fromBlock, toBlock int64) error {
+	if fromBlock > toBlock {
+		return fmt.Errorf("from block %d is after to block %d", fromBlock, toBlock)
+	}
+	progress, err := b.resume(fromBlock, toBlock)
+	if err != nil {
+		return err
+	}
+	b.lastCheckpoint = time.Now()
+
+	if err := b.replayTrades(&progress); err != nil {
+		return err
+	}
+	if err := b.replayTransfers(&progress); err != nil {
+		return err
+	}
+
+	err = b.storage.WriteSnapshot(b.output, b.chain, storage.SnapshotBlocks{
+		LastTradeBlock:    toBlock,
+		LastTransferBlock: toBlock,
+	})
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	_ = os.Remove(b.progressPath)
+	_ = os.Remove(b.checkpointPath)
+	b.log.Infow("backfill done", "output", b.output, "fromBlock", fromBlock, "toBlock", toBlock,
+		"droppedTrades", progress.DroppedTrades, "droppedTransfers", progress.DroppedTransfers)
+	return nil
+}
+
+// resume loads the checkpoint if the saved progress is of the same range.
+func (b *Backfill) resume(fromBlock, toBlock int64) (BackfillProgress, error) {
+	progress := BackfillProgress{
+		Chain:             b.chain,
+		FromBlock:         fromBlock,
+		ToBlock:           toBlock,
+		LastTradeBlock:    fromBlock - 1,
+		LastTransferBlock: fromBlock - 1,
+	}
+	content, err := os.ReadFile(b.progressPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return progress, fmt.Errorf("read progress: %w", err)
+	}
+	var saved BackfillProgress
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return progress, fmt.Errorf("parse progress: %w", err)
+	}
+	if saved.Chain != b.chain || saved.FromBlock != fromBlock || saved.ToBlock != toBlock {
+		b.log.Warnw("progress is of another range, start over", "progress", saved)
+		return progress, nil
+	}
+	if _, err := b.storage.LoadSnapshot(b.checkpointPath, b.chain, 0); err != nil {
+		b.log.Warnw("couldn't load checkpoint, start over", "path", b.checkpointPath, "err", err)
+		return progress, nil
+	}
+	b.log.Infow("resume backfill", "progress", saved)
+	return saved, nil
+}
+
+// checkpoint saves the storage and the progress at most once per backfillCheckpointDuration.
+func (b *Backfill) checkpoint(progress BackfillProgress) error {
+	if time.Since(b.lastCheckpoint) < backfillCheckpointDuration {
+		return nil
+	}
+	b.lastCheckpoint = time.Now()
+	err := b.storage.WriteSnapshot(b.checkpointPath, b.chain, storage.SnapshotBlocks{
+		LastTradeBlock:    progress.LastTradeBlock,
+		LastTransferBlock: progress.LastTransferBlock,
+	})
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	content, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(b.progressPath, content, 0o644); err != nil {
+		return fmt.Errorf("write progress: %w", err)
+	}
+	b.log.Infow("checkpoint backfill", "progress", progress)
+	return nil
+}
+
+func (b *Backfill) logProgress(kind string, block int64, progress BackfillProgress, rows, dropped, totalDropped int) {
+	done := float64(block-progress.FromBlock+1) / float64(progress.ToBlock-progress.FromBlock+1) * 100
+	b.log.Infow("backfill "+kind,
+		"block", block,
+		"toBlock", progress.ToBlock,
+		"progress", fmt.Sprintf("%.2f%%", done),
+		"rows", rows,
+		"dropped", dropped,
+		"totalDropped", totalDropped)
+}
+
+// replayTrades adds the trades after progress.LastTradeBlock up to progress.ToBlock, a block that is cut
+// by the page limit is read again on resume and its added trades are skipped by storage.
+func (b *Backfill) replayTrades(progress *BackfillProgress) error {
+	after := db.BlockStart(progress.LastTradeBlock + 1)
+	for progress.LastTradeBlock < progress.ToBlock {
+		page, err := b.db.GetSolTrades(b.tradeTable, after, limitLogs)
+		if err != nil {
+			return fmt.Errorf("get trades: %w", err)
+		}
+		end := sort.Search(len(page), func(i int) bool {
+			return int64(page[i].BlockNumber) > progress.ToBlock
+		})
+		rows := page[:end]
+		logs, dropped := handleTrades(b.storage.GetTokenUsdtRate(b.chain), rows)
+		dropped += b.storage.AddTradeLogs(b.chain, logs).Dropped
+		progress.DroppedTrades += dropped
+
+		if end < len(page) || len(page) < limitLogs {
+			progress.LastTradeBlock = progress.ToBlock
+		} else {
+			last := rows[len(rows)-1]
+			progress.LastTradeBlock = int64(last.BlockNumber) - 1
+			after = db.LogPosition{Block: int64(last.BlockNumber), LogIndex: int64(last.LogIndex)}
+		}
+		b.logProgress("trades", progress.LastTradeBlock, *progress, len(rows), dropped, progress.DroppedTrades)
+		if err := b.checkpoint(*progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayTransfers adds the transfers after progress.LastTransferBlock up to progress.ToBlock.
+func (b *Backfill) replayTransfers(progress *BackfillProgress) error {
+	after := db.BlockStart(progress.LastTransferBlock + 1)
+	for progress.LastTransferBlock < progress.ToBlock {
+		page, err := b.db.GetSolTransfer(b.transferTable, after, limitLogs)
+		if err != nil {
+			return fmt.Errorf("get transfers: %w", err)
+		}
+		end := sort.Search(len(page), func(i int) bool {
+			return int64(page[i].BlockNumber) > progress.ToBlock
+		})
+		rows := page[:end]
+		logs, dropped := handleTransfer(b.storage.GetTokenUsdtRate(b.chain), rows)
+		dropped += b.storage.AddTransferLogs(b.chain, logs).Dropped
+		progress.DroppedTransfers += dropped
+
+		if end < len(page) || len(page) < limitLogs {
+			progress.LastTransferBlock = progress.ToBlock
+		} else {
+			last := rows[len(rows)-1]
+			progress.LastTransferBlock = int64(last.BlockNumber) - 1
+			after = db.LogPosition{Block: int64(last.BlockNumber), LogIndex: int64(last.LogIndex)}
+		}
+		b.logProgress("transfers", progress.LastTransferBlock, *progress, len(rows), dropped, progress.DroppedTransfers)
+		if err := b.checkpoint(*progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
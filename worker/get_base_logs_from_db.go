@@ -1,10 +1,14 @@
 package worker
 
 import (
-	"strings"
+	"context"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/health"
+	"github.com/kv-base-hack/base-server-api/internal/metrics"
 	"github.com/kv-base-hack/base-server-api/storage"
 	"github.com/kv-base-hack/base-server-api/storage/db"
 	"go.uber.org/zap"
@@ -14,53 +18,142 @@ const limitLogs = 200000
 
 type SolanaLogs struct {
 	log               *zap.SugaredLogger
+	chain             common.Chain
+	tradeTable        string
+	transferTable     string
 	duration          time.Duration
 	storage           *storage.Storage
 	db                db.DB
 	lastTradeBlock    int64
 	lastTransferBlock int64
 	maxRangeBlock     int64
+	compactDuration   time.Duration
+	lastCompact       time.Time
+	snapshotPath      string
+	snapshotDuration  time.Duration
+	lastSnapshot      time.Time
+	snapshotOnExit    bool
+	// notifier is nil if new logs are only polled
+	notifier         db.Notifier
+	fallbackDuration time.Duration
+	lastProcess      time.Time
+	// the latest blocks that are checked again for reorg
+	tradeBlocks    *blockTracker
+	transferBlocks *blockTracker
+	status         *health.Component
 }
 
+// NewSolanaLogs creates the worker to get trade and transfer logs of a chain from database.
+// Snapshot is disabled if snapshotDir is empty, with snapshotOnExit it is also written when Run stops.
+// With notifier, new logs are processed on notification and polled every fallbackDuration,
+// or every duration while the notifier is disconnected. The progress is reported to status, it may be nil.
 func NewSolanaLogs(log *zap.SugaredLogger, duration time.Duration,
-	db db.DB, storage *storage.Storage, lastBlock int64, maxRangeBlock int64) *SolanaLogs {
+	db db.DB, storage *storage.Storage, config common.ChainConfig, compactDuration time.Duration,
+	snapshotDir string, snapshotDuration time.Duration, snapshotOnExit bool,
+	notifier db.Notifier, fallbackDuration time.Duration, status *health.Component) *SolanaLogs {
+	var snapshotPath string
+	if snapshotDir != "" {
+		snapshotPath = filepath.Join(snapshotDir, config.Chain.String()+".snapshot")
+	}
 	return &SolanaLogs{
-		log:               log.With("worker", "getSolanaLogs"),
+		log:               log.With("worker", "getSolanaLogs", "chain", config.Chain),
+		chain:             config.Chain,
+		tradeTable:        config.TradeTable,
+		transferTable:     config.TransferTable,
 		duration:          duration,
 		db:                db,
 		storage:           storage,
-		lastTradeBlock:    lastBlock,
-		lastTransferBlock: lastBlock,
-		maxRangeBlock:     maxRangeBlock,
+		lastTradeBlock:    config.FromBlock,
+		lastTransferBlock: config.FromBlock,
+		maxRangeBlock:     config.MaxRangeBlock,
+		compactDuration:   compactDuration,
+		lastCompact:       time.Now(),
+		snapshotPath:      snapshotPath,
+		snapshotDuration:  snapshotDuration,
+		lastSnapshot:      time.Now(),
+		snapshotOnExit:    snapshotOnExit,
+		notifier:          notifier,
+		fallbackDuration:  fallbackDuration,
+		tradeBlocks:       newBlockTracker(config.ConfirmationBlocks),
+		transferBlocks:    newBlockTracker(config.ConfirmationBlocks),
+		status:            status,
 	}
 }
 
-func (g *SolanaLogs) Run() {
+// Run processes the new logs until ctx is cancelled, then writes the final snapshot if it is enabled.
+// If ctx is cancelled during init, it returns without snapshot as the data is incomplete.
+func (g *SolanaLogs) Run(ctx context.Context) {
 	now := time.Now()
-	g.init()
+	g.init(ctx)
+	if ctx.Err() != nil {
+		g.log.Infow("stop during init", "duration", time.Since(now))
+		return
+	}
+	g.status.Initialized()
 	g.log.Debugw("Execution time", "init", time.Since(now))
+
+	var notify <-chan struct{}
+	if g.notifier != nil {
+		notify = g.notifier.Subscribe(g.tradeTable, g.transferTable)
+	}
 	ticker := time.NewTicker(g.duration)
-	for ; ; <-ticker.C {
-		g.process()
+	defer ticker.Stop()
+	for {
+		g.process(ctx)
+		if !g.wait(ctx, notify, ticker.C) {
+			break
+		}
+	}
+	if g.snapshotOnExit {
+		g.saveSnapshot()
+	}
+}
+
+// wait returns true when there may be new logs: on notification, or on tick if the notifier
+// is disconnected or the last process is older than fallbackDuration. It returns false if ctx is cancelled.
+func (g *SolanaLogs) wait(ctx context.Context, notify <-chan struct{}, tick <-chan time.Time) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-notify:
+			return true
+		case <-tick:
+			if g.notifier == nil || !g.notifier.Connected() || time.Since(g.lastProcess) >= g.fallbackDuration {
+				return true
+			}
+		}
 	}
 }
 
-func (g *SolanaLogs) handleTrades(trades []db.SolanaTradelogDB) []common.Tradelog {
-	ratesMap := g.storage.GetTokenUsdtRate()
+// addTrades converts the trades and adds them to storage, the trades without rate are counted as dropped.
+func (g *SolanaLogs) addTrades(trades []db.SolanaTradelogDB) {
+	logs, dropped := handleTrades(g.storage.GetTokenUsdtRate(g.chain), trades)
+	res := g.storage.AddTradeLogs(g.chain, logs)
+	res.Dropped += dropped
+	metrics.AddLogs(g.chain, metrics.Trades, res)
+}
+
+// handleTrades converts the trades and sets their profit at ratesMap, the trades of token without rate are dropped.
+// It returns the number of dropped trades.
+func handleTrades(ratesMap map[string]float64, trades []db.SolanaTradelogDB) ([]common.Tradelog, int) {
 	logs := []common.Tradelog{}
+	dropped := 0
 
 	for _, t := range trades {
 		solTradeLog := t.Convert()
-		currentRateOfTokenIn, exist := ratesMap[strings.ToLower(t.TokenInAddress)]
+		currentRateOfTokenIn, exist := ratesMap[common.AddressKey(t.TokenInAddress)]
 		if !exist {
 			solTradeLog.GetCurrentRateFail = true
 			solTradeLog.Profit = 0
+			dropped++
 			continue
 		}
-		currentRateOfTokenOut, exist := ratesMap[strings.ToLower(t.TokenOutAddress)]
+		currentRateOfTokenOut, exist := ratesMap[common.AddressKey(t.TokenOutAddress)]
 		if !exist {
 			solTradeLog.GetCurrentRateFail = true
 			solTradeLog.Profit = 0
+			dropped++
 			continue
 		}
 		profitOfTokenIn := (currentRateOfTokenIn - t.TokenInUsdtRate) * t.TokenInAmount
@@ -73,166 +166,362 @@ func (g *SolanaLogs) handleTrades(trades []db.SolanaTradelogDB) []common.Tradelo
 
 		logs = append(logs, solTradeLog)
 	}
-	return logs
+	return logs, dropped
 }
 
-func (g *SolanaLogs) initSolanaTrade() {
-	currentBlock, err := g.db.GetMaxBlockNumber(db.SolanaTradeTable)
+func (g *SolanaLogs) initSolanaTrade(ctx context.Context) {
+	currentBlock, err := g.db.GetMaxBlockNumber(g.tradeTable)
 	lastTradeBlock := g.lastTradeBlock
-	var lastTradeBlockTs time.Time
 	if err == nil && currentBlock-g.maxRangeBlock > lastTradeBlock {
 		lastTradeBlock = currentBlock - g.maxRangeBlock
 	}
+	trades, err := g.getTrades(ctx, lastTradeBlock)
+	if err != nil {
+		g.log.Errorw("error when init old trades", "lastTradeBlock", lastTradeBlock, "err", err)
+		return
+	}
+	g.log.Infow("initSolanaTrade",
+		"currentBlock", currentBlock,
+		"fromBlock", lastTradeBlock,
+		"oldTrades", len(trades))
+	if len(trades) > 0 {
+		lastTradeBlock = int64(trades[len(trades)-1].BlockNumber)
+	}
+
+	g.addTrades(trades)
+
+	g.lastTradeBlock = lastTradeBlock
+}
+
+// getTrades returns the trades from fromBlock to the latest one, the pages are split in a block by log index.
+// It stops with the error of ctx when ctx is cancelled between the pages.
+func (g *SolanaLogs) getTrades(ctx context.Context, fromBlock int64) ([]db.SolanaTradelogDB, error) {
+	after := db.BlockStart(fromBlock)
 	trades := []db.SolanaTradelogDB{}
 	for {
-		oldTrades, err := g.db.GetSolTrades(lastTradeBlock, limitLogs)
-		g.log.Infow("initSolanaTrade",
-			"currentBlock", currentBlock,
-			"lastTradeBlock", lastTradeBlock,
-			"lastTradeBlockTs", lastTradeBlockTs,
-			"oldTrades", len(oldTrades))
-		if err != nil {
-			g.log.Errorw("error when init old trades", "lastTradeBlock", lastTradeBlock, "err", err)
-			return
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		if len(oldTrades) == 0 {
-			break
-		}
-		lastTradeBlock = int64(oldTrades[len(oldTrades)-1].BlockNumber)
-		lastTradeBlockTs = oldTrades[len(oldTrades)-1].BlockTimestamp
-		// remove old tx added to trades that get again from oldTrades
-		for len(trades) > 0 && trades[len(trades)-1].BlockNumber == oldTrades[0].BlockNumber {
-			trades = trades[:len(trades)-1]
+		page, err := g.db.GetSolTrades(g.tradeTable, after, limitLogs)
+		if err != nil {
+			return nil, err
 		}
-		trades = append(trades, oldTrades...)
-		if lastTradeBlock >= currentBlock {
-			break
+		trades = append(trades, page...)
+		if len(page) < limitLogs {
+			return trades, nil
 		}
+		last := page[len(page)-1]
+		after = db.LogPosition{Block: int64(last.BlockNumber), LogIndex: int64(last.LogIndex)}
+		g.log.Debugw("get next trades page", "after", after)
 	}
+}
 
-	logs := g.handleTrades(trades)
-	g.storage.AddTradeLogs(common.ChainBase, logs)
-
-	g.lastTradeBlock = lastTradeBlock
+// addTransfers converts the transfers and adds them to storage, the transfers without rate are counted as dropped.
+func (g *SolanaLogs) addTransfers(transfers []db.SolanaTransferLogDb) {
+	logs, dropped := handleTransfer(g.storage.GetTokenUsdtRate(g.chain), transfers)
+	res := g.storage.AddTransferLogs(g.chain, logs)
+	res.Dropped += dropped
+	metrics.AddLogs(g.chain, metrics.Transfers, res)
 }
 
-func (g *SolanaLogs) handleTransfer(transfers []db.SolanaTransferLogDb) []common.Transferlog {
-	ratesMap := g.storage.GetTokenUsdtRate()
+// handleTransfer converts the transfers and sets their rate from ratesMap, the transfers of token without rate are dropped.
+// It returns the number of dropped transfers.
+func handleTransfer(ratesMap map[string]float64, transfers []db.SolanaTransferLogDb) ([]common.Transferlog, int) {
 	logs := []common.Transferlog{}
+	dropped := 0
 	for _, t := range transfers {
 		transfer := t.Convert()
-		currentRate, exist := ratesMap[strings.ToLower(t.TokenAddress)]
+		currentRate, exist := ratesMap[common.AddressKey(t.TokenAddress)]
 		if !exist {
 			transfer.GetCurrentRateFail = true
+			dropped++
 			continue
 		}
 		transfer.GetCurrentRateFail = false
 		transfer.CurrentTokenUsdtRate = currentRate
 		logs = append(logs, transfer)
 	}
-	return logs
+	return logs, dropped
 }
 
-func (g *SolanaLogs) initSolanaTransfer() {
-	currentBlock, err := g.db.GetMaxBlockNumber(db.SolanaTransferTable)
+func (g *SolanaLogs) initSolanaTransfer(ctx context.Context) {
+	currentBlock, err := g.db.GetMaxBlockNumber(g.transferTable)
 	lastTransferBlock := g.lastTransferBlock
-	var lastTransferBlockTs time.Time
 	if err == nil && currentBlock-g.maxRangeBlock > lastTransferBlock {
 		lastTransferBlock = currentBlock - g.maxRangeBlock
 	}
+	transfers, err := g.getTransfers(ctx, lastTransferBlock)
+	if err != nil {
+		g.log.Errorw("error when init old transfers", "lastTransferBlock", lastTransferBlock, "err", err)
+		return
+	}
+	g.log.Infow("initSolanaTransfer",
+		"currentBlock", currentBlock,
+		"fromBlock", lastTransferBlock,
+		"oldTransfers", len(transfers))
+	if len(transfers) > 0 {
+		lastTransferBlock = int64(transfers[len(transfers)-1].BlockNumber)
+	}
+
+	g.addTransfers(transfers)
 
-	transfer := []db.SolanaTransferLogDb{}
+	g.lastTransferBlock = lastTransferBlock
+}
+
+// getTransfers returns the transfers from fromBlock to the latest one, the pages are split in a block by log index.
+// It stops with the error of ctx when ctx is cancelled between the pages.
+func (g *SolanaLogs) getTransfers(ctx context.Context, fromBlock int64) ([]db.SolanaTransferLogDb, error) {
+	after := db.BlockStart(fromBlock)
+	transfers := []db.SolanaTransferLogDb{}
 	for {
-		oldTransfers, err := g.db.GetSolTransfer(lastTransferBlock, limitLogs)
-		g.log.Infow("initSolanaTransfer",
-			"currentBlock", currentBlock,
-			"lastTransferBlock", lastTransferBlock,
-			"lastTransferBlockTs", lastTransferBlockTs,
-			"oldTransfers", len(oldTransfers))
-		if err != nil {
-			g.log.Errorw("error when init old oldTransfers", "lastTransferBlock", lastTransferBlock, "err", err)
-			return
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		if len(oldTransfers) == 0 {
-			break
-		}
-		lastTransferBlock = int64(oldTransfers[len(oldTransfers)-1].BlockNumber)
-		lastTransferBlockTs = oldTransfers[len(oldTransfers)-1].BlockTimestamp
-		// remove old tx added to transfer that get again from oldTransfers
-		for len(transfer) > 0 && transfer[len(transfer)-1].BlockNumber == oldTransfers[0].BlockNumber {
-			transfer = transfer[:len(transfer)-1]
+		page, err := g.db.GetSolTransfer(g.transferTable, after, limitLogs)
+		if err != nil {
+			return nil, err
 		}
-		transfer = append(transfer, oldTransfers...)
-		if lastTransferBlock >= currentBlock {
-			break
+		transfers = append(transfers, page...)
+		if len(page) < limitLogs {
+			return transfers, nil
 		}
+		last := page[len(page)-1]
+		after = db.LogPosition{Block: int64(last.BlockNumber), LogIndex: int64(last.LogIndex)}
+		g.log.Debugw("get next transfers page", "after", after)
+	}
+}
+
+// loadSnapshot restores storage from the snapshot, the missing blocks are caught up by process.
+func (g *SolanaLogs) loadSnapshot() bool {
+	if g.snapshotPath == "" {
+		return false
+	}
+	// a snapshot out of max range block is too old, init from database is faster than catching up.
+	// It is checked before storage is replaced, so init starts from empty data.
+	var minTradeBlock int64
+	currentBlock, err := g.db.GetMaxBlockNumber(g.tradeTable)
+	if err == nil {
+		minTradeBlock = currentBlock - g.maxRangeBlock
+	}
+	block, err := g.storage.LoadSnapshot(g.snapshotPath, g.chain, minTradeBlock)
+	if err != nil {
+		g.log.Warnw("couldn't load snapshot, init from database",
+			"path", g.snapshotPath, "currentBlock", currentBlock, "err", err)
+		return false
 	}
+	g.lastTradeBlock = block.LastTradeBlock
+	g.lastTransferBlock = block.LastTransferBlock
+	return true
+}
 
-	logs := g.handleTransfer(transfer)
-	g.storage.AddTransferLogs(common.ChainBase, logs)
+func (g *SolanaLogs) writeSnapshot() {
+	if time.Since(g.lastSnapshot) < g.snapshotDuration {
+		return
+	}
+	g.saveSnapshot()
+}
 
-	g.lastTransferBlock = lastTransferBlock
+func (g *SolanaLogs) saveSnapshot() {
+	if g.snapshotPath == "" {
+		return
+	}
+	g.lastSnapshot = time.Now()
+	err := g.storage.WriteSnapshot(g.snapshotPath, g.chain, storage.SnapshotBlocks{
+		LastTradeBlock:    g.lastTradeBlock,
+		LastTransferBlock: g.lastTransferBlock,
+	})
+	if err != nil {
+		g.log.Errorw("error when write snapshot", "path", g.snapshotPath, "err", err)
+		return
+	}
+	g.log.Infow("write snapshot", "path", g.snapshotPath, "duration", time.Since(g.lastSnapshot))
 }
 
-func (g *SolanaLogs) init() {
+func (g *SolanaLogs) init(ctx context.Context) {
 	now := time.Now()
-	g.initSolanaTrade()
-	g.initSolanaTransfer()
+	// the blocks that are already ingested can't be rolled back, track the new blocks only
+	defer func() {
+		g.tradeBlocks.start(g.lastTradeBlock + 1)
+		g.transferBlocks.start(g.lastTransferBlock + 1)
+	}()
+	if g.loadSnapshot() {
+		g.log.Infow("Execution time", "init from snapshot duration(s)", time.Since(now).Seconds())
+		return
+	}
+	g.initSolanaTrade(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	g.initSolanaTransfer(ctx)
 	g.log.Infow("Execution time", "init duration(s)", time.Since(now).Seconds())
 }
 
-func (g *SolanaLogs) processNewTrade() {
-	newTrades, err := g.db.GetSolTrades(g.lastTradeBlock+1, limitLogs)
+func (g *SolanaLogs) processNewTrade(ctx context.Context) error {
+	from := g.tradeBlocks.window(g.lastTradeBlock)
+	newTrades, err := g.getTrades(ctx, from)
 	if err != nil {
-		g.log.Errorw("error when init new trades", "block", g.lastTradeBlock+1, "err", err)
-		return
+		g.log.Errorw("error when init new trades", "block", from, "err", err)
+		return err
+	}
+	hashes := blockHashes(newTrades, func(t db.SolanaTradelogDB) int64 { return int64(t.BlockNumber) })
+	if block, ok := g.tradeBlocks.reorgBlock(hashes, from, g.lastTradeBlock); ok {
+		g.rollbackTrades(block)
 	}
+	defer func() {
+		g.tradeBlocks.record(hashes, g.lastTradeBlock)
+	}()
+
+	// skip the blocks that are already ingested, the last one is added again for the late logs
+	// and storage skips the logs that are already added
+	i := sort.Search(len(newTrades), func(i int) bool {
+		return int64(newTrades[i].BlockNumber) >= g.lastTradeBlock
+	})
+	newTrades = newTrades[i:]
 	lenNewTrades := len(newTrades)
 	g.log.Debugw("add new trade", "block", g.lastTradeBlock+1, "len", lenNewTrades)
 	if lenNewTrades == 0 {
-		return
+		return nil
 	}
 
-	logs := g.handleTrades(newTrades)
-	g.storage.AddTradeLogs(common.ChainBase, logs)
+	g.addTrades(newTrades)
 
 	if lenNewTrades > 0 {
 		g.lastTradeBlock = int64(newTrades[lenNewTrades-1].BlockNumber)
 	}
+	return nil
 }
 
-func (g *SolanaLogs) processNewTransfer() {
-	newTransfer, err := g.db.GetSolTransfer(g.lastTransferBlock+1, limitLogs)
+// rollbackTrades removes the trades from block, they are added again from the canonical rows.
+func (g *SolanaLogs) rollbackTrades(block int64) {
+	removed := g.storage.RollbackTrades(g.chain, uint64(block))
+	g.log.Warnw("reorg of trades, rollback", "block", block, "lastTradeBlock", g.lastTradeBlock, "removed", removed)
+	g.tradeBlocks.rollback(block)
+	g.lastTradeBlock = block - 1
+}
+
+func (g *SolanaLogs) processNewTransfer(ctx context.Context) error {
+	from := g.transferBlocks.window(g.lastTransferBlock)
+	newTransfer, err := g.getTransfers(ctx, from)
 	if err != nil {
-		g.log.Errorw("error when init new transfer", "block", g.lastTransferBlock+1, "err", err)
-		return
+		g.log.Errorw("error when init new transfer", "block", from, "err", err)
+		return err
+	}
+	hashes := blockHashes(newTransfer, func(t db.SolanaTransferLogDb) int64 { return int64(t.BlockNumber) })
+	if block, ok := g.transferBlocks.reorgBlock(hashes, from, g.lastTransferBlock); ok {
+		g.rollbackTransfers(block)
 	}
+	defer func() {
+		g.transferBlocks.record(hashes, g.lastTransferBlock)
+	}()
+
+	// skip the blocks that are already ingested except the last one
+	i := sort.Search(len(newTransfer), func(i int) bool {
+		return int64(newTransfer[i].BlockNumber) >= g.lastTransferBlock
+	})
+	newTransfer = newTransfer[i:]
 	lenNewTransfer := len(newTransfer)
 	g.log.Debugw("add new transfer", "block", g.lastTransferBlock+1, "len", lenNewTransfer)
 	if lenNewTransfer == 0 {
-		return
+		return nil
 	}
-	logs := g.handleTransfer(newTransfer)
-	g.storage.AddTransferLogs(common.ChainBase, logs)
+	g.addTransfers(newTransfer)
 
 	if lenNewTransfer > 0 {
 		g.lastTransferBlock = int64(newTransfer[lenNewTransfer-1].BlockNumber)
 	}
+	return nil
+}
+
+// rollbackTransfers removes the transfers from block, they are added again from the canonical rows.
+func (g *SolanaLogs) rollbackTransfers(block int64) {
+	removed := g.storage.RollbackTransfers(g.chain, uint64(block))
+	g.log.Warnw("reorg of transfers, rollback", "block", block, "lastTransferBlock", g.lastTransferBlock, "removed", removed)
+	g.transferBlocks.rollback(block)
+	g.lastTransferBlock = block - 1
 }
 
 func (g *SolanaLogs) removeStaleTrade() {
-	g.storage.RemoveTrades(g.log, common.ChainBase)
+	g.storage.RemoveTrades(g.log, g.chain)
 }
 
 func (g *SolanaLogs) removeStaleTransfer() {
-	g.storage.RemoveTransfer(g.log, common.ChainBase)
+	g.storage.RemoveTransfer(g.log, g.chain)
 }
 
-func (g *SolanaLogs) process() {
+func (g *SolanaLogs) compactLogs() {
+	if time.Since(g.lastCompact) < g.compactDuration {
+		return
+	}
+	g.lastCompact = time.Now()
+	res := g.storage.CompactLogs(g.chain)
+	g.log.Infow("compact logs",
+		"tradeLogsRemoved", res.TradeLogsRemoved,
+		"transferLogsRemoved", res.TransferLogsRemoved,
+		"positionsRemoved", res.PositionsRemoved,
+		"reclaimedBytes", res.ReclaimedBytes,
+		"duration", time.Since(g.lastCompact))
+}
+
+// restoreQueuedSnapshot restores the snapshot uploaded to the admin api, the blocks after it are caught up by process.
+func (g *SolanaLogs) restoreQueuedSnapshot() {
+	blocks, ok, err := g.storage.RestoreQueuedSnapshot(g.chain)
+	if err != nil {
+		g.log.Errorw("error when restore queued snapshot", "err", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	g.log.Infow("restore queued snapshot",
+		"lastTradeBlock", blocks.LastTradeBlock,
+		"lastTransferBlock", blocks.LastTransferBlock)
+	g.lastTradeBlock = blocks.LastTradeBlock
+	g.lastTransferBlock = blocks.LastTransferBlock
+	g.tradeBlocks.start(g.lastTradeBlock + 1)
+	g.transferBlocks.start(g.lastTransferBlock + 1)
+}
+
+// reportStatus reports the process result and the lag behind the database to the health status.
+func (g *SolanaLogs) reportStatus(err error) {
+	if err != nil {
+		g.status.Failure(err)
+		return
+	}
+	maxTradeBlock, err := g.db.GetMaxBlockNumber(g.tradeTable)
+	if err != nil {
+		g.log.Errorw("error when get max trade block", "err", err)
+		g.status.Failure(err)
+		return
+	}
+	maxTransferBlock, err := g.db.GetMaxBlockNumber(g.transferTable)
+	if err != nil {
+		g.log.Errorw("error when get max transfer block", "err", err)
+		g.status.Failure(err)
+		return
+	}
+	lag := maxTradeBlock - g.lastTradeBlock
+	transferLag := maxTransferBlock - g.lastTransferBlock
+	metrics.SetLag(g.chain, metrics.Trades, lag)
+	metrics.SetLag(g.chain, metrics.Transfers, transferLag)
+	if transferLag > lag {
+		lag = transferLag
+	}
+	g.status.SetLag(lag)
+	g.status.Success()
+}
+
+func (g *SolanaLogs) process(ctx context.Context) {
 	now := time.Now()
-	g.processNewTrade()
-	g.processNewTransfer()
+	g.lastProcess = now
+	g.restoreQueuedSnapshot()
+	err := g.processNewTrade(ctx)
+	if transferErr := g.processNewTransfer(ctx); err == nil {
+		err = transferErr
+	}
+	g.reportStatus(err)
 	g.removeStaleTrade()
 	g.removeStaleTransfer()
+	g.compactLogs()
+	g.writeSnapshot()
 	g.log.Infow("Execution time", "process duration(s)", time.Since(now).Seconds())
 }
@@ -1,10 +1,12 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
 	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/health"
 	"github.com/kv-base-hack/base-server-api/storage"
 	inmem "github.com/kv-base-hack/common/inmem_db"
 	"go.uber.org/zap"
@@ -17,25 +19,37 @@ type TokenInfoWorker struct {
 	duration time.Duration
 	inMemDB  inmem.Inmem
 	storage  *storage.Storage
+	status   *health.Component
 }
 
-func NewTokenInfoWorker(log *zap.SugaredLogger, duration time.Duration, inMemDB inmem.Inmem, storage *storage.Storage) *TokenInfoWorker {
+// NewTokenInfoWorker creates the worker to get the token info from redis, status may be nil.
+func NewTokenInfoWorker(log *zap.SugaredLogger, duration time.Duration, inMemDB inmem.Inmem, storage *storage.Storage,
+	status *health.Component) *TokenInfoWorker {
 	return &TokenInfoWorker{
 		log:      log.With("worker", "token_info"),
 		duration: duration,
 		inMemDB:  inMemDB,
 		storage:  storage,
+		status:   status,
 	}
 }
 
 func (t *TokenInfoWorker) Init() {
 	t.process()
+	t.status.Initialized()
 }
 
-func (t *TokenInfoWorker) Run() {
+// Run updates the token info every duration until ctx is cancelled.
+func (t *TokenInfoWorker) Run(ctx context.Context) {
 	ticker := time.NewTicker(t.duration)
-	for ; ; <-ticker.C {
+	defer ticker.Stop()
+	for {
 		t.process()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -43,13 +57,16 @@ func (t *TokenInfoWorker) process() {
 	infoBytes, err := t.inMemDB.Get(cmcTokenInfoKey)
 	if err != nil {
 		t.log.Errorw("error when get token info", "err", err)
+		t.status.Failure(err)
 		return
 	}
 
 	var info common.CmcTokens
 	if err = json.Unmarshal([]byte(infoBytes), &info); err != nil {
 		t.log.Errorw("error when parse token info", "info", infoBytes, "err", err)
+		t.status.Failure(err)
 		return
 	}
 	t.storage.SetSymbolToTokenInfoFromCmc(info)
+	t.status.Success()
 }
@@ -1,55 +1,80 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
 	"github.com/kv-base-hack/base-server-api/common"
+	"github.com/kv-base-hack/base-server-api/internal/health"
+	"github.com/kv-base-hack/base-server-api/internal/metrics"
 	"github.com/kv-base-hack/base-server-api/storage"
 	inmem "github.com/kv-base-hack/common/inmem_db"
 	"go.uber.org/zap"
 )
 
-const ratePricesKey = "dex_screener_prices"
+// DefaultRatePricesKey is the redis key of token rates from dexscreener.
+const DefaultRatePricesKey = "dex_screener_prices"
 
 type GetRate struct {
 	log      *zap.SugaredLogger
+	chain    common.Chain
+	rateKey  string
 	inMemDB  inmem.Inmem
 	duration time.Duration
 	storage  *storage.Storage
+	status   *health.Component
 }
 
-func NewGetRate(log *zap.SugaredLogger, inMemDB inmem.Inmem, duration time.Duration, storage *storage.Storage) *GetRate {
+// NewGetRate creates the worker to get the rates of a chain from redis, status may be nil.
+func NewGetRate(log *zap.SugaredLogger, inMemDB inmem.Inmem, duration time.Duration, storage *storage.Storage,
+	chain common.Chain, rateKey string, status *health.Component) *GetRate {
 	return &GetRate{
-		log:      log.With("worker", "getRate"),
+		log:      log.With("worker", "getRate", "chain", chain),
+		chain:    chain,
+		rateKey:  rateKey,
 		inMemDB:  inMemDB,
 		duration: duration,
 		storage:  storage,
+		status:   status,
 	}
 }
 
 func (r *GetRate) Init() {
 	r.process()
+	r.status.Initialized()
 }
 
-func (r *GetRate) Run() {
+// Run updates the rates every duration until ctx is cancelled.
+func (r *GetRate) Run(ctx context.Context) {
 	ticker := time.NewTicker(r.duration)
-	for ; ; <-ticker.C {
+	defer ticker.Stop()
+	for {
 		r.process()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
 func (r *GetRate) process() {
-	rates, err := r.inMemDB.Get(ratePricesKey)
+	rates, err := r.inMemDB.Get(r.rateKey)
 	if err != nil {
 		r.log.Errorw("error when get rate", "err", err)
+		r.status.Failure(err)
+		metrics.RateFetchFailed(r.chain)
 		return
 	}
 	var ratesList []common.Token
 	if err = json.Unmarshal([]byte(rates), &ratesList); err != nil {
 		r.log.Errorw("error when parse rate", "rates", rates, "err", err)
+		r.status.Failure(err)
+		metrics.RateFetchFailed(r.chain)
 		return
 	}
-	r.storage.SetTokenUsdtRate(ratesList)
-	r.storage.SetAddrToTokenInfo(ratesList)
+	r.storage.SetTokenUsdtRate(r.chain, ratesList)
+	r.storage.SetAddrToTokenInfo(r.chain, ratesList)
+	r.status.Success()
 }
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"time"
 
 	"github.com/kv-base-hack/base-server-api/lib/coingecko"
@@ -22,10 +23,17 @@ func NewGetTrendingWorker(log *zap.SugaredLogger, coingecko *coingecko.CoinGecko
 	}
 }
 
-func (g *GetTrendingWorker) Run() {
+// Run updates the trending tokens every 6 hours until ctx is cancelled.
+func (g *GetTrendingWorker) Run(ctx context.Context) {
 	t := time.NewTicker(time.Hour * 6)
-	for ; ; <-t.C {
+	defer t.Stop()
+	for {
 		g.Do()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
 	}
 }
 
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// blockTracker keeps a hash of the latest blocks to detect the blocks that are rewritten by the indexer after a reorg.
+// The log tables have no block hash, so the hash of a block is the hash of its rows, it changes when the block is replaced.
+type blockTracker struct {
+	depth int64
+	// the blocks before from are ingested before tracking, they are not checked
+	from   int64
+	hashes map[int64]string
+}
+
+func newBlockTracker(depth int64) *blockTracker {
+	return &blockTracker{
+		depth:  depth,
+		hashes: make(map[int64]string),
+	}
+}
+
+// start tracks the blocks from block, the tracked blocks are dropped.
+func (t *blockTracker) start(block int64) {
+	t.from = block
+	t.hashes = make(map[int64]string)
+}
+
+// window returns the first block to get again, it is at most the last ingested block.
+func (t *blockTracker) window(last int64) int64 {
+	from := last - t.depth + 1
+	if from < t.from {
+		from = t.from
+	}
+	if from > last {
+		from = last
+	}
+	return from
+}
+
+// reorgBlock returns the first tracked block in [from, last] whose hash is changed.
+func (t *blockTracker) reorgBlock(hashes map[int64]string, from, last int64) (int64, bool) {
+	var (
+		res   int64
+		found bool
+	)
+	check := func(block int64) {
+		if block < from || block < t.from || block > last || hashes[block] == t.hashes[block] {
+			return
+		}
+		if !found || block < res {
+			res, found = block, true
+		}
+	}
+	for block := range t.hashes {
+		check(block)
+	}
+	for block := range hashes {
+		check(block)
+	}
+	return res, found
+}
+
+// rollback drops the blocks from block.
+func (t *blockTracker) rollback(block int64) {
+	for b := range t.hashes {
+		if b >= block {
+			delete(t.hashes, b)
+		}
+	}
+}
+
+// record keeps the hashes of the tracked blocks up to last and drops the blocks out of the depth.
+func (t *blockTracker) record(hashes map[int64]string, last int64) {
+	for block, hash := range hashes {
+		if block >= t.from && block <= last {
+			t.hashes[block] = hash
+		}
+	}
+	for block := range t.hashes {
+		if block <= last-t.depth {
+			delete(t.hashes, block)
+		}
+	}
+}
+
+// blockHashes returns the hash of the rows of each block, the order of the rows in a block doesn't matter.
+func blockHashes[T any](rows []T, blockOf func(T) int64) map[int64]string {
+	byBlock := make(map[int64][]string)
+	for _, row := range rows {
+		block := blockOf(row)
+		byBlock[block] = append(byBlock[block], fmt.Sprintf("%v", row))
+	}
+	res := make(map[int64]string, len(byBlock))
+	for block, values := range byBlock {
+		sort.Strings(values)
+		h := sha256.New()
+		for _, v := range values {
+			h.Write([]byte(v))
+			h.Write([]byte{0})
+		}
+		res[block] = hex.EncodeToString(h.Sum(nil))
+	}
+	return res
+}
@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"testing"
+)
+
+type testRow struct {
+	Block int64
+	Value string
+}
+
+func testHashes(rows []testRow) map[int64]string {
+	return blockHashes(rows, func(r testRow) int64 { return r.Block })
+}
+
+func TestBlockTrackerReorgBlock(t *testing.T) {
+	ingested := []testRow{
+		{Block: 1, Value: "a"},
+		{Block: 2, Value: "b"},
+		{Block: 3, Value: "c"},
+		{Block: 3, Value: "d"},
+		{Block: 4, Value: "e"},
+		{Block: 5, Value: "f"},
+	}
+
+	tests := []struct {
+		name      string
+		rows      []testRow
+		wantBlock int64
+		wantFound bool
+	}{
+		{
+			name: "same rows in another order",
+			rows: []testRow{
+				{Block: 3, Value: "d"},
+				{Block: 3, Value: "c"},
+				{Block: 4, Value: "e"},
+				{Block: 5, Value: "f"},
+			},
+		},
+		{
+			name: "new block only",
+			rows: []testRow{
+				{Block: 3, Value: "c"},
+				{Block: 3, Value: "d"},
+				{Block: 4, Value: "e"},
+				{Block: 5, Value: "f"},
+				{Block: 6, Value: "g"},
+			},
+		},
+		{
+			name: "replaced rows",
+			rows: []testRow{
+				{Block: 3, Value: "c"},
+				{Block: 3, Value: "d"},
+				{Block: 4, Value: "x"},
+				{Block: 5, Value: "y"},
+			},
+			wantBlock: 4,
+			wantFound: true,
+		},
+		{
+			name: "removed row",
+			rows: []testRow{
+				{Block: 3, Value: "c"},
+				{Block: 4, Value: "e"},
+				{Block: 5, Value: "f"},
+			},
+			wantBlock: 3,
+			wantFound: true,
+		},
+		{
+			name: "removed block",
+			rows: []testRow{
+				{Block: 3, Value: "c"},
+				{Block: 3, Value: "d"},
+				{Block: 4, Value: "e"},
+			},
+			wantBlock: 5,
+			wantFound: true,
+		},
+		{
+			name: "changed block out of depth",
+			rows: []testRow{
+				{Block: 2, Value: "x"},
+				{Block: 3, Value: "c"},
+				{Block: 3, Value: "d"},
+				{Block: 4, Value: "e"},
+				{Block: 5, Value: "f"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newBlockTracker(3)
+			tracker.start(1)
+			tracker.record(testHashes(ingested), 5)
+
+			from := tracker.window(5)
+			if from != 3 {
+				t.Fatalf("window = %d, want 3", from)
+			}
+			block, found := tracker.reorgBlock(testHashes(tt.rows), from, 5)
+			if found != tt.wantFound || block != tt.wantBlock {
+				t.Errorf("reorgBlock = %d, %v, want %d, %v", block, found, tt.wantBlock, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestBlockTrackerRollback(t *testing.T) {
+	tracker := newBlockTracker(10)
+	// the blocks before 3 are ingested before tracking
+	tracker.start(3)
+	tracker.record(testHashes([]testRow{
+		{Block: 2, Value: "a"},
+		{Block: 3, Value: "b"},
+		{Block: 4, Value: "c"},
+		{Block: 5, Value: "d"},
+	}), 5)
+	if _, exist := tracker.hashes[2]; exist {
+		t.Fatal("block 2 is recorded before the start of tracking")
+	}
+
+	canonical := []testRow{
+		{Block: 3, Value: "b"},
+		{Block: 4, Value: "x"},
+		{Block: 5, Value: "y"},
+	}
+	block, found := tracker.reorgBlock(testHashes(canonical), tracker.window(5), 5)
+	if !found || block != 4 {
+		t.Fatalf("reorgBlock = %d, %v, want 4, true", block, found)
+	}
+
+	// the canonical blocks are ingested again after the rollback and are not a reorg anymore
+	tracker.rollback(block)
+	if len(tracker.hashes) != 1 {
+		t.Fatalf("tracked blocks after rollback = %v, want block 3 only", tracker.hashes)
+	}
+	tracker.record(testHashes(canonical), 5)
+	if block, found := tracker.reorgBlock(testHashes(canonical), tracker.window(5), 5); found {
+		t.Errorf("reorgBlock after ingesting the canonical blocks = %d, want none", block)
+	}
+}
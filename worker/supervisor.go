@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supervisor starts the workers with a context and waits for them to stop after it is cancelled.
+type Supervisor struct {
+	log *zap.SugaredLogger
+	wg  sync.WaitGroup
+}
+
+func NewSupervisor(log *zap.SugaredLogger) *Supervisor {
+	return &Supervisor{
+		log: log.With("worker", "supervisor"),
+	}
+}
+
+// Go runs the worker in a goroutine, run must return when ctx is cancelled.
+func (s *Supervisor) Go(ctx context.Context, name string, run func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		run(ctx)
+		s.log.Infow("worker stopped", "name", name)
+	}()
+}
+
+// Wait waits for all workers to stop, it returns false if they are still running after timeout.
+func (s *Supervisor) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}